@@ -0,0 +1,127 @@
+package fixedfield
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Byte slices and arrays are opaque blocks, rather than a repeat of
+// single byte integers, unless they have a repeat or repeatFrom tag.
+func isBlock(fieldType reflect.Type, tag reflect.StructTag) bool {
+	return isRepeated(fieldType) && fieldType.Elem().Kind() == reflect.Uint8 &&
+		len(tag.Get("repeat")) == 0 && len(tag.Get("repeatFrom")) == 0
+}
+
+// Hex and base64 are the text encodings of a byte field.
+func isTextBytes(encoding string) bool {
+	switch strings.ToLower(encoding) {
+	case "hex", "base64":
+		return true
+	}
+	return false
+}
+
+// Return the number of bytes needed to hold n bytes of data in the
+// given encoding.  Anything other than hex or base64 is written raw.
+func encodedBytesLen(encoding string, n int) int {
+	switch strings.ToLower(encoding) {
+	case "hex":
+		return hex.EncodedLen(n)
+	case "base64":
+		return base64.StdEncoding.EncodedLen(n)
+	}
+	return n
+}
+
+// Convert the contents of a byte field into the form they take in
+// the record.  Hex and base64 are text, and so pass through the
+// charset.
+func encodeBytes(s spec, value []byte) []byte {
+	switch strings.ToLower(s.Encoding) {
+	case "hex":
+		return s.Charset.encode([]byte(hex.EncodeToString(value)))
+	case "base64":
+		return s.Charset.encode([]byte(base64.StdEncoding.EncodeToString(value)))
+	}
+	return value
+}
+
+// Convert a block read from the record into the contents of a byte
+// field.  Text encodings may be padded with trailing spaces.
+func decodeBytes(s spec, block []byte) (value []byte, err error) {
+	var text string
+
+	switch strings.ToLower(s.Encoding) {
+	case "hex":
+		text = strings.TrimRight(s.Charset.decodeString(block), " ")
+		value, err = hex.DecodeString(text)
+	case "base64":
+		text = strings.TrimRight(s.Charset.decodeString(block), " ")
+		value, err = base64.StdEncoding.DecodeString(text)
+	default:
+		return block, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+	}
+	return value, nil
+}
+
+// Read a byte slice or array field from a block of bytes.  An array
+// is filled from the start, with any remaining elements zeroed.
+func readBytes(s spec, block []byte) (err error) {
+	var value []byte
+
+	value, err = decodeBytes(s, block)
+	if err != nil {
+		return err
+	}
+	if s.Value.Kind() == reflect.Slice {
+		s.Value.SetBytes(append([]byte(nil), value...))
+		return nil
+	}
+	if len(value) > s.Value.Len() {
+		return fmt.Errorf("Field %s.%s holds %d bytes, but %d were read",
+			s.StructName, s.StructField.Name, s.Value.Len(), len(value))
+	}
+	s.Value.Set(reflect.Zero(s.Value.Type()))
+	reflect.Copy(s.Value, reflect.ValueOf(value))
+	return nil
+}
+
+// Return the contents of a byte slice or array field.
+func bytesValue(value reflect.Value) []byte {
+	var result []byte
+
+	if value.Kind() == reflect.Slice {
+		return value.Bytes()
+	}
+	result = make([]byte, value.Len())
+	reflect.Copy(reflect.ValueOf(result), value)
+	return result
+}
+
+// Write a byte slice or array field as a block of s.Length bytes.
+// Raw blocks are padded with zero bytes, and text encodings with
+// spaces.
+func marshalBytes(s spec) (block []byte, err error) {
+	var padding []byte = []byte{0}
+
+	block = encodeBytes(s, bytesValue(s.Value))
+	if len(block) > s.Length {
+		// Truncated hex or base64 text can't be decoded.
+		if !s.Truncate || isTextBytes(s.Encoding) {
+			return nil, fmt.Errorf("Field %s.%s overflowed configured field length (Tried to write %d bytes to a %d length field)",
+				s.StructName, s.StructField.Name, len(block), s.Length)
+		}
+		return block[:s.Length], nil
+	}
+	if isTextBytes(s.Encoding) {
+		padding = s.Charset.encode([]byte(" "))
+	}
+	return append(block, bytes.Repeat(padding, s.Length-len(block))...), nil
+}
@@ -0,0 +1,174 @@
+package fixedfield
+
+import (
+	. "launchpad.net/gocheck"
+)
+
+type BytesSuite struct{}
+
+var _ = Suite(&BytesSuite{})
+
+// Byte slices and arrays are read and written as whole blocks.
+func (s *BytesSuite) TestMarshalUnmarshalRawBytes(c *C) {
+	type record struct {
+		Signature []byte `length:"4"`
+		Reserved  [3]byte
+		Code      string `length:"2"`
+	}
+	data := []byte("\xde\xad\xbe\xef" + "\x00\x01\x02" + "OK")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Signature, DeepEquals, []byte{0xde, 0xad, 0xbe, 0xef})
+	c.Assert(result.Reserved, Equals, [3]byte{0, 1, 2})
+	c.Assert(result.Code, Equals, "OK")
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, data)
+}
+
+// The block handed back by Unmarshal doesn't share memory with the
+// input.
+func (s *BytesSuite) TestUnmarshalCopiesBytes(c *C) {
+	type record struct {
+		Signature []byte `length:"2"`
+	}
+	data := []byte("ab")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	data[0] = 'z'
+	c.Assert(string(result.Signature), Equals, "ab")
+}
+
+// Short raw blocks are padded with zero bytes, and long ones are an
+// error unless they may be truncated.
+func (s *BytesSuite) TestMarshalRawBytesLength(c *C) {
+	type record struct {
+		Signature []byte `length:"4"`
+	}
+	output, err := Marshal(&record{Signature: []byte{1, 2}})
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, []byte{1, 2, 0, 0})
+
+	_, err = Marshal(&record{Signature: []byte{1, 2, 3, 4, 5}})
+	c.Assert(err, ErrorMatches, "Field .*Signature overflowed configured field length \\(Tried to write 5 bytes to a 4 length field\\)")
+
+	type truncated struct {
+		Signature []byte `length:"4" truncate:"true"`
+	}
+	output, err = Marshal(&truncated{Signature: []byte{1, 2, 3, 4, 5}})
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, []byte{1, 2, 3, 4})
+}
+
+// Byte fields may be written as hex or base64 text, padded with
+// spaces.
+func (s *BytesSuite) TestMarshalUnmarshalTextBytes(c *C) {
+	type record struct {
+		Hash    [4]byte `encoding:"hex"`
+		Token   []byte  `length:"12" encoding:"base64"`
+		Trailer []byte  `length:"6" encoding:"HEX"`
+	}
+	data := []byte("deadbeef" + "AQID        " + "0a0b  ")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Hash, Equals, [4]byte{0xde, 0xad, 0xbe, 0xef})
+	c.Assert(result.Token, DeepEquals, []byte{1, 2, 3})
+	c.Assert(result.Trailer, DeepEquals, []byte{0x0a, 0x0b})
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, string(data))
+
+	err = Unmarshal([]byte("deadbeeg"+"AQID        "+"0a0b  "), result)
+	c.Assert(err, ErrorMatches, "Field .*Hash: encoding/hex: invalid byte: .*")
+}
+
+// Hex text passes through the charset like any other text field.
+func (s *BytesSuite) TestTextBytesCharset(c *C) {
+	type record struct {
+		Hash [2]byte `encoding:"hex" charset:"037"`
+	}
+	result := &record{}
+	err := Unmarshal([]byte("\xf0\xc1\xf1\xc2"), result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Hash, Equals, [2]byte{0x0a, 0x1b})
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, []byte("\xf0\x81\xf1\x82"))
+}
+
+// A byte slice may take its length from an earlier field.
+func (s *BytesSuite) TestBytesLengthFrom(c *C) {
+	type record struct {
+		Size    uint16 `length:"2" encoding:"be"`
+		Payload []byte `lengthFrom:"Size"`
+	}
+	result := &record{}
+	err := Unmarshal([]byte("\x00\x03\x01\x02\x03"), result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Payload, DeepEquals, []byte{1, 2, 3})
+	output, err := Marshal(&record{Payload: []byte{4, 5}})
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, []byte{0, 2, 4, 5})
+	output, err = Marshal(&record{})
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, []byte{0, 0})
+}
+
+// With a repeat tag, byte fields are still a repeat of single byte
+// integers.
+func (s *BytesSuite) TestRepeatedBytes(c *C) {
+	type record struct {
+		Digits []uint8  `length:"1" repeat:"3" encoding:"ascii"`
+		Words  [2]uint8 `length:"2" repeat:"2" encoding:"be"`
+	}
+	data := []byte("123" + "\x00\x07\x00\x09")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Digits, DeepEquals, []uint8{1, 2, 3})
+	c.Assert(result.Words, Equals, [2]uint8{7, 9})
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, data)
+}
+
+// With a repeatFrom tag, a byte slice holds as many single byte
+// integers as the count field says.
+func (s *BytesSuite) TestBytesRepeatFrom(c *C) {
+	type record struct {
+		N    uint8
+		Data []byte `repeatFrom:"N"`
+		Code string `length:"2"`
+	}
+	data := []byte("\x03\x01\x02\x03OK")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(result.N, Equals, uint8(3))
+	c.Assert(result.Data, DeepEquals, []byte{1, 2, 3})
+	c.Assert(result.Code, Equals, "OK")
+	output, err := Marshal(&record{Data: []byte{1, 2, 3}, Code: "OK"})
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, data)
+}
+
+// A byte array must fit in its length.
+func (s *BytesSuite) TestBytesInvalidLength(c *C) {
+	type short struct {
+		Hash [4]byte `length:"6" encoding:"hex"`
+	}
+	_, err := buildSpecs(&short{})
+	c.Assert(err, ErrorMatches, "Field .*Hash has a length of 6, but needs 8 bytes")
+}
+
+// Hex and base64 text is never truncated, as it couldn't be decoded.
+func (s *BytesSuite) TestTextBytesAreNotTruncated(c *C) {
+	type record struct {
+		Token []byte `length:"4" encoding:"hex" truncate:"true"`
+	}
+	_, err := Marshal(&record{Token: []byte{1, 2, 3}})
+	c.Assert(err, ErrorMatches, "Field .*Token overflowed configured field length \\(Tried to write 6 bytes to a 4 length field\\)")
+}
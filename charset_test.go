@@ -0,0 +1,159 @@
+package fixedfield
+
+import (
+	"bytes"
+	. "launchpad.net/gocheck"
+)
+
+type CharsetSuite struct{}
+
+var _ = Suite(&CharsetSuite{})
+
+// lookupCharset accepts the common spellings of a code page name.
+func (s *CharsetSuite) TestLookupCharset(c *C) {
+	for _, name := range []string{"037", "37", "cp037", "IBM037", "ibm-037"} {
+		cs, err := lookupCharset(name)
+		c.Assert(err, IsNil)
+		c.Assert(cs.name, Equals, "037")
+	}
+	_, err := lookupCharset("cp1252")
+	c.Assert(err, ErrorMatches, "Unsupported charset 'cp1252'.*")
+}
+
+// Text round trips through each of the EBCDIC code pages.
+func (s *CharsetSuite) TestEncodeDecodeString(c *C) {
+	cs, _ := lookupCharset("037")
+	block, err := cs.encodeString("Hello 123")
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\xc8\x85\x93\x93\x96\x40\xf1\xf2\xf3"))
+	c.Assert(cs.decodeString(block), Equals, "Hello 123")
+
+	for _, name := range []string{"273", "500", "1047"} {
+		cs, _ = lookupCharset(name)
+		block, err = cs.encodeString("Grüße [^]")
+		c.Assert(err, IsNil)
+		c.Assert(cs.decodeString(block), Equals, "Grüße [^]")
+	}
+}
+
+// The code pages differ in where they put punctuation.
+func (s *CharsetSuite) TestCodePageDifferences(c *C) {
+	cs037, _ := lookupCharset("037")
+	cs1047, _ := lookupCharset("1047")
+	cs273, _ := lookupCharset("273")
+	c.Assert(cs037.encode([]byte("^")), DeepEquals, []byte("\xb0"))
+	c.Assert(cs1047.encode([]byte("^")), DeepEquals, []byte("\x5f"))
+	c.Assert(cs273.decodeString([]byte("\x4a")), Equals, "Ä")
+}
+
+// Characters outside of Latin-1 cannot be encoded.
+func (s *CharsetSuite) TestEncodeStringUnrepresentable(c *C) {
+	cs, _ := lookupCharset("500")
+	_, err := cs.encodeString("5€")
+	c.Assert(err, ErrorMatches, "Character '€' cannot be represented in code page 500")
+}
+
+// Text fields are translated, whilst binary fields in the same record
+// are left alone.
+func (s *CharsetSuite) TestMarshalUnmarshalMixedRecord(c *C) {
+	type record struct {
+		Name    string  `length:"4" charset:"037"`
+		Count   int     `length:"3" encoding:"ascii" charset:"037"`
+		Binary  int     `length:"2" encoding:"be"`
+		Amount  float64 `length:"4" encoding:"ascii" charset:"037"`
+		Flagged bool    `encoding:"ascii" charset:"037"`
+	}
+	data := []byte("\xc2\xd6\xc2\x40" + "\x40\xf4\xf2" + "\x00\x25" + "\x40\xf1\x4b\xf5" + "\xe8")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(*result, Equals, record{Name: "BOB", Count: 42, Binary: 37, Amount: 1.5, Flagged: true})
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, data)
+}
+
+// The Decoder and Encoder charset applies to fields without a charset
+// tag, but doesn't override an explicit one.
+func (s *CharsetSuite) TestDefaultCharset(c *C) {
+	type record struct {
+		Name  string `length:"3"`
+		Plain string `length:"2" charset:"ascii"`
+	}
+	decoder := NewDecoder(bytes.NewBuffer([]byte("\xc2\xd6\xc2OK")))
+	err := decoder.SetCharset("1047")
+	c.Assert(err, IsNil)
+	result := &record{}
+	err = decoder.Decode(result)
+	c.Assert(err, IsNil)
+	c.Assert(*result, Equals, record{Name: "BOB", Plain: "OK"})
+
+	output := bytes.NewBuffer(nil)
+	encoder := NewEncoder(output)
+	err = encoder.SetCharset("1047")
+	c.Assert(err, IsNil)
+	err = encoder.Encode(result)
+	c.Assert(err, IsNil)
+	encoder.Flush()
+	c.Assert(output.Bytes(), DeepEquals, []byte("\xc2\xd6\xc2OK"))
+
+	err = encoder.SetCharset("klingon")
+	c.Assert(err, ErrorMatches, "Unsupported charset 'klingon'.*")
+}
+
+// The Decoder charset applies to the elements of a slice of structs,
+// without leaking into later calls that don't set it.
+func (s *CharsetSuite) TestDefaultCharsetSliceOfStructs(c *C) {
+	type record struct {
+		People []Person `repeat:"1"`
+	}
+	decoder := NewDecoder(bytes.NewBuffer([]byte("\xc2\xd6\xc2@@\x07")))
+	err := decoder.SetCharset("1047")
+	c.Assert(err, IsNil)
+	result := &record{}
+	err = decoder.Decode(result)
+	c.Assert(err, IsNil)
+	c.Assert(result.People, DeepEquals, []Person{{"BOB", 7}})
+
+	err = Unmarshal([]byte("Alan \x07"), result)
+	c.Assert(err, IsNil)
+	c.Assert(result.People, DeepEquals, []Person{{"Alan", 7}})
+}
+
+// The gaps between positioned fields are filled with spaces in the
+// record's charset.
+func (s *CharsetSuite) TestDefaultCharsetOffsetGaps(c *C) {
+	type record struct {
+		Code string `length:"2" offset:"3"`
+		Name string `length:"2" offset:"0"`
+	}
+	output := bytes.NewBuffer(nil)
+	encoder := NewEncoder(output)
+	err := encoder.SetCharset("037")
+	c.Assert(err, IsNil)
+	err = encoder.Encode(&record{Code: "AB", Name: "CD"})
+	c.Assert(err, IsNil)
+	encoder.Flush()
+	c.Assert(output.Bytes(), DeepEquals, []byte("\xc3\xc4\x40\xc1\xc2"))
+}
+
+// A charset tag applies only to its own field, so the gaps around it
+// are in the record's charset.
+func (s *CharsetSuite) TestTaggedCharsetOffsetGaps(c *C) {
+	type record struct {
+		Code string `length:"2" offset:"1" charset:"037"`
+		Name string `length:"1" offset:"4" charset:"ascii"`
+	}
+	output, err := Marshal(&record{Code: "AB", Name: "C"})
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, []byte("\x20\xc1\xc2\x20C"))
+
+	buffer := bytes.NewBuffer(nil)
+	encoder := NewEncoder(buffer)
+	err = encoder.SetCharset("037")
+	c.Assert(err, IsNil)
+	err = encoder.Encode(&record{Code: "AB", Name: "C"})
+	c.Assert(err, IsNil)
+	encoder.Flush()
+	c.Assert(buffer.Bytes(), DeepEquals, []byte("\x40\xc1\xc2\x40C"))
+}
@@ -0,0 +1,157 @@
+package fixedfield
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A Decimal is an exact fixed point number, equal to Unscaled ×
+// 10^-Scale.  It can be used in place of a float for fields, such as
+// currency amounts, where rounding errors are unacceptable.
+type Decimal struct {
+	Unscaled int64
+	Scale    int
+}
+
+var decimalType = reflect.TypeOf(Decimal{})
+
+// Return the decimal in its conventional notation, e.g. "-123.45".
+func (d Decimal) String() string {
+	var digits, sign string
+
+	if d.Scale <= 0 {
+		return strconv.FormatInt(d.Unscaled, 10) + strings.Repeat("0", -d.Scale)
+	}
+	digits = strconv.FormatInt(d.Unscaled, 10)
+	if d.Unscaled < 0 {
+		sign = "-"
+		digits = digits[1:]
+	}
+	if len(digits) <= d.Scale {
+		digits = strings.Repeat("0", d.Scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-d.Scale] + "." + digits[len(digits)-d.Scale:]
+}
+
+// ParseDecimal reads a decimal from its conventional notation, e.g.
+// "-123.45".  The scale of the result is the number of digits after
+// the decimal point.
+func ParseDecimal(text string) (d Decimal, err error) {
+	var digits string = text
+	var point int
+
+	if strings.HasPrefix(digits, "+") || strings.HasPrefix(digits, "-") {
+		digits = digits[1:]
+	}
+	point = strings.Index(digits, ".")
+	if point >= 0 {
+		d.Scale = len(digits) - point - 1
+		digits = digits[:point] + digits[point+1:]
+	}
+	if len(digits) == 0 || strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+		return Decimal{}, fmt.Errorf("Invalid decimal %q", text)
+	}
+	d.Unscaled, err = strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Decimal{}, fmt.Errorf("Decimal %q overflows a 64 bit integer", text)
+	}
+	if strings.HasPrefix(text, "-") {
+		d.Unscaled = -d.Unscaled
+	}
+	return d, nil
+}
+
+// Convert a float to a decimal, using the shortest representation
+// that reads back as the same float.
+func floatToDecimal(value float64, bitSize int) (d Decimal, err error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return Decimal{}, fmt.Errorf("Value %g cannot be represented as a decimal", value)
+	}
+	return ParseDecimal(strconv.FormatFloat(value, 'f', -1, bitSize))
+}
+
+// Convert the decimal to the nearest float of the given bit size.
+func (d Decimal) float(bitSize int) (value float64, err error) {
+	return strconv.ParseFloat(d.String(), bitSize)
+}
+
+// The rounding modes that may be given in a field's rounding tag.  An
+// empty mode means digits may not be discarded at all.
+var roundingModes = []string{"halfup", "halfeven", "down", "up", "ceiling", "floor"}
+
+// Having divided a magnitude by divisor, giving quotient and
+// remainder, decide whether the quotient should be rounded away from
+// zero.
+func roundAway(quotient, remainder, divisor uint64, negative bool, mode string) bool {
+	if remainder == 0 {
+		return false
+	}
+	switch mode {
+	case "halfup":
+		return remainder >= divisor-remainder
+	case "halfeven":
+		return remainder > divisor-remainder || (remainder == divisor-remainder && quotient%2 != 0)
+	case "up":
+		return true
+	case "ceiling":
+		return !negative
+	case "floor":
+		return negative
+	}
+	return false
+}
+
+// Return the unscaled value of the decimal when expressed with the
+// given scale, discarding digits according to the rounding mode.  An
+// error is returned if this would overflow, or would discard non-zero
+// digits when no rounding mode is given.
+func (d Decimal) round(scale int, mode string) (value int64, err error) {
+	var magnitude, divisor, quotient, remainder uint64
+	var negative bool
+
+	value = d.Unscaled
+	for s := d.Scale; s < scale; s++ {
+		if value > maxInt64/10 || value < minInt64/10 {
+			return 0, fmt.Errorf("Decimal %s overflows when given %d decimal places", d, scale)
+		}
+		value *= 10
+	}
+	if d.Scale <= scale {
+		return value, nil
+	}
+
+	negative = value < 0
+	magnitude = uint64(value)
+	if negative {
+		magnitude = uint64(-value)
+	}
+	if d.Scale-scale >= 20 {
+		// Every digit is discarded, and what's left is less than half.
+		quotient, remainder, divisor = 0, magnitude, math.MaxUint64
+	} else {
+		divisor = 1
+		for s := d.Scale; s > scale; s-- {
+			divisor *= 10
+		}
+		quotient, remainder = magnitude/divisor, magnitude%divisor
+	}
+	if remainder != 0 && mode == "" {
+		return 0, fmt.Errorf("Decimal %s cannot be represented with %d decimal places", d, scale)
+	}
+	if roundAway(quotient, remainder, divisor, negative, mode) {
+		quotient++
+	}
+	value = int64(quotient)
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
+
+const (
+	maxInt64 = 1<<63 - 1
+	minInt64 = -1 << 63
+)
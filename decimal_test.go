@@ -0,0 +1,229 @@
+package fixedfield
+
+import (
+	. "launchpad.net/gocheck"
+)
+
+type DecimalSuite struct{}
+
+var _ = Suite(&DecimalSuite{})
+
+// Test that a Decimal prints in conventional notation.
+func (s *DecimalSuite) TestString(c *C) {
+	c.Assert(Decimal{Unscaled: 12345, Scale: 2}.String(), Equals, "123.45")
+	c.Assert(Decimal{Unscaled: -5, Scale: 3}.String(), Equals, "-0.005")
+	c.Assert(Decimal{Unscaled: 42, Scale: 0}.String(), Equals, "42")
+	c.Assert(Decimal{Unscaled: 42, Scale: -2}.String(), Equals, "4200")
+}
+
+// Test that round, without a rounding mode, is exact and fails rather
+// than lose precision.
+func (s *DecimalSuite) TestRoundExact(c *C) {
+	value, err := Decimal{Unscaled: 125, Scale: 1}.round(3, "")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(12500))
+	value, err = Decimal{Unscaled: 12500, Scale: 3}.round(1, "")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(125))
+	_, err = Decimal{Unscaled: 12345, Scale: 3}.round(1, "")
+	c.Assert(err, ErrorMatches, "Decimal 12.345 cannot be represented with 1 decimal places")
+	_, err = Decimal{Unscaled: maxInt64 / 5, Scale: 0}.round(1, "")
+	c.Assert(err, ErrorMatches, ".*overflows when given 1 decimal places")
+
+	value, err = Decimal{Unscaled: -125, Scale: 1}.round(3, "")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(-12500))
+	value, err = Decimal{Unscaled: -12500, Scale: 3}.round(1, "")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(-125))
+	_, err = Decimal{Unscaled: -12345, Scale: 3}.round(1, "")
+	c.Assert(err, ErrorMatches, "Decimal -12.345 cannot be represented with 1 decimal places")
+	_, err = Decimal{Unscaled: minInt64 / 5, Scale: 0}.round(1, "")
+	c.Assert(err, ErrorMatches, ".*overflows when given 1 decimal places")
+}
+
+// Test each of the rounding modes on positive and negative halves.
+func (s *DecimalSuite) TestRoundModes(c *C) {
+	expected := map[string][]int64{
+		"halfup":   {13, 12, -13, -12, 12},
+		"halfeven": {12, 12, -12, -12, 12},
+		"down":     {12, 12, -12, -12, 12},
+		"up":       {13, 13, -13, -13, 13},
+		"ceiling":  {13, 13, -12, -12, 13},
+		"floor":    {12, 12, -13, -13, 12},
+	}
+	inputs := []Decimal{{125, 1}, {1201, 2}, {-125, 1}, {-1201, 2}, {1249999, 5}}
+	for mode, results := range expected {
+		for i, d := range inputs {
+			value, err := d.round(0, mode)
+			c.Assert(err, IsNil)
+			c.Assert(value, Equals, results[i], Commentf("%s %s", mode, d))
+		}
+	}
+	value, err := Decimal{Unscaled: 135, Scale: 1}.round(0, "halfeven")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(14))
+}
+
+// Test that round copes with discarding every digit.
+func (s *DecimalSuite) TestRoundAllDigits(c *C) {
+	value, err := Decimal{Unscaled: maxInt64, Scale: 19}.round(0, "halfup")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(1))
+	value, err = Decimal{Unscaled: maxInt64, Scale: 25}.round(0, "halfup")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(0))
+	value, err = Decimal{Unscaled: -1, Scale: 25}.round(0, "floor")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(-1))
+}
+
+// Test ParseDecimal on valid and invalid input.
+func (s *DecimalSuite) TestParseDecimal(c *C) {
+	d, err := ParseDecimal("-123.45")
+	c.Assert(err, IsNil)
+	c.Assert(d, Equals, Decimal{Unscaled: -12345, Scale: 2})
+	d, err = ParseDecimal("+0012")
+	c.Assert(err, IsNil)
+	c.Assert(d, Equals, Decimal{Unscaled: 12, Scale: 0})
+	_, err = ParseDecimal("12a")
+	c.Assert(err, ErrorMatches, `Invalid decimal "12a"`)
+	_, err = ParseDecimal("-")
+	c.Assert(err, ErrorMatches, `Invalid decimal "-"`)
+}
+
+// Floats are converted to decimals by their shortest representation,
+// so 1.005 rounds as a person would expect.
+func (s *DecimalSuite) TestFloatToDecimal(c *C) {
+	d, err := floatToDecimal(1.005, 64)
+	c.Assert(err, IsNil)
+	c.Assert(d, Equals, Decimal{Unscaled: 1005, Scale: 3})
+	value, err := d.round(2, "halfup")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(101))
+}
+
+// ASCII and binary integer fields may be read into, and written from,
+// floats and Decimals with an implied decimal point.
+func (s *DecimalSuite) TestMarshalUnmarshalImpliedScale(c *C) {
+	type record struct {
+		Amount  float64 `length:"10" encoding:"ascii" scale:"2"`
+		Rate    float32 `length:"4" encoding:"be" scale:"4"`
+		Balance Decimal `length:"8" encoding:"ascii" scale:"2"`
+		Total   Decimal `length:"2" encoding:"le" scale:"1"`
+	}
+	data := []byte("0000012345" + "\x00\x00\x30\x39" + "   -1050" + "\x39\x30")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Amount, Equals, 123.45)
+	c.Assert(result.Rate, Equals, float32(1.2345))
+	c.Assert(result.Balance, Equals, Decimal{Unscaled: -1050, Scale: 2})
+	c.Assert(result.Total, Equals, Decimal{Unscaled: 12345, Scale: 1})
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, "     12345"+"\x00\x00\x30\x39"+"   -1050"+"\x39\x30")
+}
+
+// A padding tag of "0" round trips zero filled amounts, with any sign
+// ahead of the zeros.
+func (s *DecimalSuite) TestMarshalUnmarshalZeroPadded(c *C) {
+	type record struct {
+		Amount  float64 `length:"10" encoding:"ascii" scale:"2" padding:"0"`
+		Balance Decimal `length:"8" encoding:"ascii" scale:"2" padding:"0"`
+		Count   int     `length:"6" encoding:"ascii" padding:"0"`
+		Units   uint    `length:"4" encoding:"ascii" padding:"0"`
+	}
+	data := []byte("0000012345" + "-0001050" + "-00042" + "0007")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Amount, Equals, 123.45)
+	c.Assert(result.Balance, Equals, Decimal{Unscaled: -1050, Scale: 2})
+	c.Assert(result.Count, Equals, -42)
+	c.Assert(result.Units, Equals, uint(7))
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, string(data))
+}
+
+// Writing uses the rounding tag; floats default to rounding half up
+// and Decimals refuse to discard digits unless a mode is given.
+func (s *DecimalSuite) TestMarshalRounding(c *C) {
+	type floats struct {
+		HalfUp   float64 `length:"4" encoding:"ascii" scale:"2"`
+		HalfEven float64 `length:"4" encoding:"ascii" scale:"2" rounding:"halfeven"`
+		Floor    float64 `length:"4" encoding:"ascii" scale:"2" rounding:"floor"`
+	}
+	output, err := Marshal(&floats{HalfUp: 1.005, HalfEven: 1.005, Floor: -1.001})
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, " 101 100-101")
+
+	type exact struct {
+		Value Decimal `length:"4" encoding:"ascii" scale:"1"`
+	}
+	_, err = Marshal(&exact{Value: Decimal{Unscaled: 105, Scale: 2}})
+	c.Assert(err, ErrorMatches, ".*Decimal 1.05 cannot be represented with 1 decimal places")
+
+	type rounded struct {
+		Value Decimal `length:"4" encoding:"ascii" scale:"1" rounding:"up"`
+	}
+	output, err = Marshal(&rounded{Value: Decimal{Unscaled: 101, Scale: 2}})
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, "  11")
+}
+
+// An unknown rounding mode is a layout error.
+func (s *DecimalSuite) TestInvalidRounding(c *C) {
+	type record struct {
+		Value float64 `length:"4" encoding:"ascii" scale:"1" rounding:"bankers"`
+	}
+	_, err := buildSpecs(&record{})
+	c.Assert(err, ErrorMatches, "Invalid rounding tag 'bankers'.*")
+}
+
+// ASCII Decimal fields with an explicit decimal point round trip, and
+// the precision tag fixes the number of decimal places written.
+func (s *DecimalSuite) TestMarshalUnmarshalASCIIDecimal(c *C) {
+	type record struct {
+		Amount Decimal `length:"10" encoding:"ascii"`
+		Fixed  Decimal `length:"8" encoding:"ascii" precision:"2"`
+	}
+	data := []byte("  -1234.50" + "   12.30")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Amount, Equals, Decimal{Unscaled: -123450, Scale: 2})
+	c.Assert(result.Fixed, Equals, Decimal{Unscaled: 1230, Scale: 2})
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, string(data))
+
+	result.Fixed = Decimal{Unscaled: 7, Scale: 0}
+	output, err = Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(string(output[10:]), Equals, "    7.00")
+	result.Fixed = Decimal{Unscaled: 7001, Scale: 3}
+	_, err = Marshal(result)
+	c.Assert(err, ErrorMatches, ".*cannot be represented with 2 decimal places")
+}
+
+// Amounts too large to be held exactly in a float64 survive a trip
+// through each of the decimal encodings.
+func (s *DecimalSuite) TestDecimalPrecision(c *C) {
+	type record struct {
+		ASCII  Decimal `length:"19" encoding:"ascii" scale:"2"`
+		Zoned  Decimal `length:"18" encoding:"zoned" scale:"2"`
+		Packed Decimal `length:"10" encoding:"packed" scale:"2"`
+	}
+	amount := Decimal{Unscaled: 123456789012345678, Scale: 2}
+	input := &record{ASCII: amount, Zoned: amount, Packed: amount}
+	data, err := Marshal(input)
+	c.Assert(err, IsNil)
+	result := &record{}
+	err = Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(*result, Equals, *input)
+	c.Assert(result.Packed.String(), Equals, "1234567890123456.78")
+	c.Assert(int64(float64(amount.Unscaled)), Not(Equals), amount.Unscaled)
+}
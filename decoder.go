@@ -0,0 +1,143 @@
+package fixedfield
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Commonly used record terminators, for use with
+// Decoder.SetTerminator and Encoder.SetTerminator.
+var (
+	TerminatorLF   = []byte("\n")
+	TerminatorCRLF = []byte("\r\n")
+)
+
+// A Decoder reads a sequence of fixed field records from an input
+// stream, one record per call to Decode.
+type Decoder struct {
+	reader     *bufio.Reader
+	terminator []byte
+	strict     bool
+	charset    *charset
+	options    layoutOptions
+	records    int
+}
+
+// Create a new Decoder that reads from r.  The Decoder buffers its
+// input and may read more data from r than is required by a single
+// record.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{reader: bufio.NewReader(r)}
+}
+
+// Set the bytes that end each record.  By default records are read
+// back to back with no terminator.  The final record in the input
+// may omit its terminator.
+func (d *Decoder) SetTerminator(terminator []byte) {
+	d.terminator = terminator
+}
+
+// In strict mode, a terminated record whose length differs from the
+// size of the target struct is an error.  Otherwise any trailing
+// bytes in the record are ignored.
+func (d *Decoder) SetStrict(strict bool) {
+	d.strict = strict
+}
+
+// Set the charset used for text fields that have no charset tag of
+// their own, e.g. "037" for EBCDIC code page 037.  The default is
+// ASCII.
+func (d *Decoder) SetCharset(name string) (err error) {
+	d.charset, err = lookupCharset(name)
+	return err
+}
+
+// Set the position of the first byte of a record, as used by offset
+// tags.  Offsets are 0-based by default; vendor layouts given as
+// column numbers are usually 1-based.  Unmarshal has no such setting,
+// and always uses 0-based offsets.
+func (d *Decoder) SetOffsetBase(base int) error {
+	if base != 0 && base != 1 {
+		return fmt.Errorf("Invalid offset base %d, must be 0 or 1", base)
+	}
+	d.options.offsetBase = base
+	return nil
+}
+
+// Read the bytes up to the next terminator, stripping the terminator
+// itself.
+func (d *Decoder) readRecord() (record []byte, err error) {
+	var chunk []byte
+	var last byte = d.terminator[len(d.terminator)-1]
+
+	for {
+		chunk, err = d.reader.ReadBytes(last)
+		record = append(record, chunk...)
+		if err != nil {
+			if err == io.EOF && len(record) > 0 {
+				// Tolerate a missing terminator on the final record.
+				return record, nil
+			}
+			return nil, err
+		}
+		if bytes.HasSuffix(record, d.terminator) {
+			return record[:len(record)-len(d.terminator)], nil
+		}
+	}
+}
+
+// Decode reads the next record from the input and stores it in the
+// struct pointed to by v.  When there are no more records Decode
+// returns io.EOF.
+func (d *Decoder) Decode(v interface{}) (err error) {
+	var specs []spec
+	var record []byte
+
+	specs, err = buildSpecsWithOptions(v, d.options)
+	if err != nil {
+		return err
+	}
+	if d.charset != nil {
+		setDefaultCharset(specs, d.charset)
+	}
+	d.records++
+	if len(d.terminator) == 0 {
+		_, err = d.reader.Peek(1)
+		if err != nil {
+			return err
+		}
+		if isVariable(specs) {
+			return populateStructFromSpecAndBytes(specs, d.reader)
+		}
+		// Consume the whole record before parsing it, so that a
+		// bad field doesn't leave the input part way through a
+		// record.
+		record, err = readBlock(d.reader, recordSize(specs))
+		if err != nil {
+			return err
+		}
+		return populateStructFromSpecAndBytes(specs, bytes.NewReader(record))
+	}
+
+	record, err = d.readRecord()
+	if err != nil {
+		return err
+	}
+	if isVariable(specs) {
+		// The expected size is only known once the record is read.
+		reader := bytes.NewReader(record)
+		err = populateStructFromSpecAndBytes(specs, reader)
+		if err == nil && d.strict && reader.Len() != 0 {
+			return fmt.Errorf("Record %d is %d bytes long, expected %d bytes",
+				d.records, len(record), len(record)-reader.Len())
+		}
+		return err
+	}
+	if d.strict && len(record) != recordSize(specs) {
+		return fmt.Errorf("Record %d is %d bytes long, expected %d bytes",
+			d.records, len(record), recordSize(specs))
+	}
+	return populateStructFromSpecAndBytes(specs, bytes.NewReader(record))
+}
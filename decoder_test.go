@@ -0,0 +1,166 @@
+package fixedfield
+
+import (
+	"bytes"
+	"io"
+	. "launchpad.net/gocheck"
+	"testing/iotest"
+)
+
+type DecoderSuite struct{}
+
+var _ = Suite(&DecoderSuite{})
+
+// Decode reads one record per call and returns io.EOF at the end of
+// the input.
+func (s *DecoderSuite) TestDecode(c *C) {
+	data := bytes.NewBufferString("Geoff\x25Elisa\x04" + "Bobby\x10Alice\x20")
+	decoder := NewDecoder(data)
+
+	transaction := &Transaction{}
+	err := decoder.Decode(transaction)
+	c.Assert(err, IsNil)
+	c.Assert(transaction.Buyer.Name, Equals, "Geoff")
+	c.Assert(transaction.Seller.Age, Equals, 4)
+
+	err = decoder.Decode(transaction)
+	c.Assert(err, IsNil)
+	c.Assert(transaction.Buyer.Name, Equals, "Bobby")
+	c.Assert(transaction.Buyer.Age, Equals, 16)
+	c.Assert(transaction.Seller.Name, Equals, "Alice")
+	c.Assert(transaction.Seller.Age, Equals, 32)
+
+	err = decoder.Decode(transaction)
+	c.Assert(err, Equals, io.EOF)
+}
+
+// Decode copes with a reader that returns a single byte at a time.
+func (s *DecoderSuite) TestDecodeShortReads(c *C) {
+	data := iotest.OneByteReader(bytes.NewBufferString("Geoff\x25Elisa\x04"))
+	decoder := NewDecoder(data)
+	transaction := &Transaction{}
+	err := decoder.Decode(transaction)
+	c.Assert(err, IsNil)
+	c.Assert(transaction.Seller.Name, Equals, "Elisa")
+}
+
+// Decode reports a truncated final record as an error rather than
+// io.EOF.
+func (s *DecoderSuite) TestDecodeTruncatedRecord(c *C) {
+	decoder := NewDecoder(bytes.NewBufferString("Geoff\x25Eli"))
+	err := decoder.Decode(&Transaction{})
+	c.Assert(err, ErrorMatches, "Buffer underrun, 9 of 12 bytes read.")
+}
+
+// Without a terminator, a record that fails to parse is still consumed
+// whole, so the following record is read from the right place.
+func (s *DecoderSuite) TestDecodeBadRecordKeepsAlignment(c *C) {
+	type record struct {
+		Count int    `length:"2" encoding:"ascii"`
+		Name  string `length:"3"`
+	}
+	decoder := NewDecoder(bytes.NewBufferString("x1ABC02DEF"))
+	target := &record{}
+	err := decoder.Decode(target)
+	c.Assert(err, NotNil)
+	err = decoder.Decode(target)
+	c.Assert(err, IsNil)
+	c.Assert(target.Count, Equals, 2)
+	c.Assert(target.Name, Equals, "DEF")
+}
+
+// Decode splits records on the terminator, tolerating a missing
+// terminator on the final record.
+func (s *DecoderSuite) TestDecodeWithTerminator(c *C) {
+	data := bytes.NewBufferString("Geoff\x25\r\nElisa\x04")
+	decoder := NewDecoder(data)
+	decoder.SetTerminator(TerminatorCRLF)
+
+	person := &Person{}
+	err := decoder.Decode(person)
+	c.Assert(err, IsNil)
+	c.Assert(person.Name, Equals, "Geoff")
+	c.Assert(person.Age, Equals, 37)
+	err = decoder.Decode(person)
+	c.Assert(err, IsNil)
+	c.Assert(person.Name, Equals, "Elisa")
+	c.Assert(person.Age, Equals, 4)
+	err = decoder.Decode(person)
+	c.Assert(err, Equals, io.EOF)
+}
+
+// Without strict mode, trailing bytes in a record are ignored.
+func (s *DecoderSuite) TestDecodeIgnoresTrailingBytes(c *C) {
+	decoder := NewDecoder(bytes.NewBufferString("Geoff\x25 extra\nElisa\x04\n"))
+	decoder.SetTerminator(TerminatorLF)
+	person := &Person{}
+	err := decoder.Decode(person)
+	c.Assert(err, IsNil)
+	c.Assert(person.Name, Equals, "Geoff")
+	err = decoder.Decode(person)
+	c.Assert(err, IsNil)
+	c.Assert(person.Name, Equals, "Elisa")
+	err = decoder.Decode(person)
+	c.Assert(err, Equals, io.EOF)
+}
+
+// In strict mode, a record of the wrong length is an error.
+func (s *DecoderSuite) TestDecodeStrict(c *C) {
+	decoder := NewDecoder(bytes.NewBufferString("Geoff\x25\nElisa\x04 \n"))
+	decoder.SetTerminator(TerminatorLF)
+	decoder.SetStrict(true)
+	person := &Person{}
+	err := decoder.Decode(person)
+	c.Assert(err, IsNil)
+	err = decoder.Decode(person)
+	c.Assert(err, ErrorMatches, "Record 2 is 7 bytes long, expected 6 bytes")
+}
+
+// Decode copes with custom, multi-byte terminators.
+func (s *DecoderSuite) TestDecodeCustomTerminator(c *C) {
+	decoder := NewDecoder(bytes.NewBufferString("Geoff\x25||Elisa\x04||"))
+	decoder.SetTerminator([]byte("||"))
+	person := &Person{}
+	err := decoder.Decode(person)
+	c.Assert(err, IsNil)
+	c.Assert(person.Name, Equals, "Geoff")
+	err = decoder.Decode(person)
+	c.Assert(err, IsNil)
+	c.Assert(person.Name, Equals, "Elisa")
+	err = decoder.Decode(person)
+	c.Assert(err, Equals, io.EOF)
+}
+
+// Decode honours 1-based offsets once the offset base is set.
+func (s *DecoderSuite) TestDecodeOffsetBase(c *C) {
+	type record struct {
+		Code string `length:"3" offset:"4"`
+	}
+	decoder := NewDecoder(bytes.NewBufferString("...ABC"))
+	err := decoder.SetOffsetBase(2)
+	c.Assert(err, ErrorMatches, "Invalid offset base 2, must be 0 or 1")
+	err = decoder.SetOffsetBase(1)
+	c.Assert(err, IsNil)
+	target := &record{}
+	err = decoder.Decode(target)
+	c.Assert(err, IsNil)
+	c.Assert(target.Code, Equals, "ABC")
+}
+
+// In strict mode, a record with variable length fields must be
+// consumed exactly.
+func (s *DecoderSuite) TestDecodeStrictLengthFrom(c *C) {
+	type record struct {
+		Size    int    `length:"1" encoding:"ascii"`
+		Payload string `lengthFrom:"Size"`
+	}
+	decoder := NewDecoder(bytes.NewBufferString("3abc\n3abcd\n"))
+	decoder.SetTerminator(TerminatorLF)
+	decoder.SetStrict(true)
+	target := &record{}
+	err := decoder.Decode(target)
+	c.Assert(err, IsNil)
+	c.Assert(target.Payload, Equals, "abc")
+	err = decoder.Decode(target)
+	c.Assert(err, ErrorMatches, "Record 2 is 5 bytes long, expected 4 bytes")
+}
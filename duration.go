@@ -0,0 +1,52 @@
+package fixedfield
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// The units that may be given in a duration's unit tag.
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// Convert a count of units read from a field into a duration.
+func countToDuration(count int64, unit time.Duration) (value int64, err error) {
+	if count > maxInt64/int64(unit) || count < minInt64/int64(unit) {
+		return 0, fmt.Errorf("%d × %s overflows a time.Duration", count, unit)
+	}
+	return count * int64(unit), nil
+}
+
+// Convert a duration into a count of units to be written to a field.
+// Durations that aren't a whole number of units are an error unless a
+// rounding mode is given.
+func durationToCount(value time.Duration, unit time.Duration, rounding string) (count int64, err error) {
+	var magnitude, quotient, remainder uint64
+	var negative bool = value < 0
+
+	magnitude = uint64(value)
+	if negative {
+		magnitude = uint64(-value)
+	}
+	quotient, remainder = magnitude/uint64(unit), magnitude%uint64(unit)
+	if remainder != 0 && rounding == "" {
+		return 0, fmt.Errorf("Duration %s is not a whole number of %s", value, unit)
+	}
+	if roundAway(quotient, remainder, uint64(unit), negative, rounding) {
+		quotient++
+	}
+	count = int64(quotient)
+	if negative {
+		count = -count
+	}
+	return count, nil
+}
@@ -0,0 +1,73 @@
+package fixedfield
+
+import (
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+type DurationSuite struct{}
+
+var _ = Suite(&DurationSuite{})
+
+// Durations are read and written as counts of their unit, in any
+// integer encoding.
+func (s *DurationSuite) TestMarshalUnmarshalDuration(c *C) {
+	type record struct {
+		Seconds time.Duration `length:"6" encoding:"ascii" unit:"s"`
+		Millis  time.Duration `length:"4" encoding:"be" unit:"ms"`
+		Minutes time.Duration `length:"3" encoding:"zoned" unit:"m"`
+		Nanos   time.Duration `length:"2" encoding:"le"`
+	}
+	data := []byte("   125" + "\x00\x00\x30\x39" + "09E" + "\x10\x00")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Seconds, Equals, 125*time.Second)
+	c.Assert(result.Millis, Equals, 12345*time.Millisecond)
+	c.Assert(result.Minutes, Equals, 95*time.Minute)
+	c.Assert(result.Nanos, Equals, 16*time.Nanosecond)
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, data)
+}
+
+// Durations that aren't a whole number of units can only be written
+// with a rounding mode.
+func (s *DurationSuite) TestMarshalDurationRounding(c *C) {
+	type exact struct {
+		Value time.Duration `length:"3" encoding:"ascii" unit:"s"`
+	}
+	_, err := Marshal(&exact{Value: 1500 * time.Millisecond})
+	c.Assert(err, ErrorMatches, ".*Duration 1.5s is not a whole number of 1s")
+
+	type rounded struct {
+		Value time.Duration `length:"3" encoding:"ascii" unit:"s" rounding:"halfup"`
+	}
+	output, err := Marshal(&rounded{Value: -1500 * time.Millisecond})
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, " -2")
+}
+
+// Reading a count that overflows a time.Duration is an error.
+func (s *DurationSuite) TestUnmarshalDurationOverflow(c *C) {
+	type record struct {
+		Value time.Duration `length:"8" encoding:"ascii" unit:"h"`
+	}
+	err := Unmarshal([]byte("99999999"), &record{})
+	c.Assert(err, ErrorMatches, "99999999 × 1h0m0s overflows a time.Duration")
+}
+
+// The unit tag is validated, and only allowed on durations.
+func (s *DurationSuite) TestInvalidUnit(c *C) {
+	type invalid struct {
+		Value time.Duration `unit:"fortnight"`
+	}
+	_, err := buildSpecs(&invalid{})
+	c.Assert(err, ErrorMatches, "Invalid unit tag 'fortnight'.*")
+
+	type notDuration struct {
+		Value int `unit:"s"`
+	}
+	_, err = buildSpecs(&notDuration{})
+	c.Assert(err, ErrorMatches, "Only time.Duration fields may have a unit tag")
+}
@@ -0,0 +1,78 @@
+package fixedfield
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// An Encoder writes a sequence of fixed field records to an output
+// stream, one record per call to Encode.
+type Encoder struct {
+	writer     *bufio.Writer
+	terminator []byte
+	charset    *charset
+	options    layoutOptions
+}
+
+// Create a new Encoder that writes to w.  Output is buffered, so
+// Flush must be called once all records have been encoded.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{writer: bufio.NewWriter(w)}
+}
+
+// Set the bytes written after each record.  By default records are
+// written back to back with no terminator.
+func (e *Encoder) SetTerminator(terminator []byte) {
+	e.terminator = terminator
+}
+
+// Set the charset used for text fields that have no charset tag of
+// their own, e.g. "037" for EBCDIC code page 037.  The default is
+// ASCII.
+func (e *Encoder) SetCharset(name string) (err error) {
+	e.charset, err = lookupCharset(name)
+	return err
+}
+
+// Set the position of the first byte of a record, as used by offset
+// tags.  Offsets are 0-based by default; vendor layouts given as
+// column numbers are usually 1-based.  Marshal has no such setting,
+// and always uses 0-based offsets.
+func (e *Encoder) SetOffsetBase(base int) error {
+	if base != 0 && base != 1 {
+		return fmt.Errorf("Invalid offset base %d, must be 0 or 1", base)
+	}
+	e.options.offsetBase = base
+	return nil
+}
+
+// Encode writes the struct pointed to by v as a single record,
+// followed by the record terminator, if one is set.
+func (e *Encoder) Encode(v interface{}) (err error) {
+	var specs []spec
+	var data []byte
+
+	specs, err = buildSpecsWithOptions(v, e.options)
+	if err != nil {
+		return err
+	}
+	if e.charset != nil {
+		setDefaultCharset(specs, e.charset)
+	}
+	data, err = populateBytesFromSpecAndStruct(specs)
+	if err != nil {
+		return err
+	}
+	_, err = e.writer.Write(data)
+	if err != nil {
+		return err
+	}
+	_, err = e.writer.Write(e.terminator)
+	return err
+}
+
+// Flush writes any buffered records to the underlying io.Writer.
+func (e *Encoder) Flush() error {
+	return e.writer.Flush()
+}
@@ -0,0 +1,70 @@
+package fixedfield
+
+import (
+	"bytes"
+	. "launchpad.net/gocheck"
+)
+
+type EncoderSuite struct{}
+
+var _ = Suite(&EncoderSuite{})
+
+// Encode writes one record per call, and nothing reaches the
+// underlying writer until Flush is called.
+func (s *EncoderSuite) TestEncode(c *C) {
+	output := bytes.NewBuffer(nil)
+	encoder := NewEncoder(output)
+	err := encoder.Encode(&Transaction{
+		Buyer:  Person{Name: "Geoff", Age: 37},
+		Seller: Person{Name: "Elisa", Age: 4}})
+	c.Assert(err, IsNil)
+	err = encoder.Encode(&Transaction{
+		Buyer:  Person{Name: "Bobby", Age: 16},
+		Seller: Person{Name: "Alice", Age: 32}})
+	c.Assert(err, IsNil)
+	c.Assert(output.Len(), Equals, 0)
+	err = encoder.Flush()
+	c.Assert(err, IsNil)
+	c.Assert(output.String(), Equals, "Geoff\x25Elisa\x04Bobby\x10Alice\x20")
+}
+
+// Encode writes the terminator after each record.
+func (s *EncoderSuite) TestEncodeWithTerminator(c *C) {
+	output := bytes.NewBuffer(nil)
+	encoder := NewEncoder(output)
+	encoder.SetTerminator(TerminatorCRLF)
+	err := encoder.Encode(&Person{Name: "Geoff", Age: 37})
+	c.Assert(err, IsNil)
+	err = encoder.Encode(&Person{Name: "Elisa", Age: 4})
+	c.Assert(err, IsNil)
+	err = encoder.Flush()
+	c.Assert(err, IsNil)
+	c.Assert(output.String(), Equals, "Geoff\x25\r\nElisa\x04\r\n")
+}
+
+// Encode reports marshalling errors without writing a partial record.
+func (s *EncoderSuite) TestEncodeError(c *C) {
+	output := bytes.NewBuffer(nil)
+	encoder := NewEncoder(output)
+	err := encoder.Encode(&Person{Name: "Geoffrey", Age: 37})
+	c.Assert(err, ErrorMatches, ".*overflowed configured field length.*")
+	err = encoder.Flush()
+	c.Assert(err, IsNil)
+	c.Assert(output.Len(), Equals, 0)
+}
+
+// Encode honours 1-based offsets once the offset base is set.
+func (s *EncoderSuite) TestEncodeOffsetBase(c *C) {
+	type record struct {
+		Code string `length:"3" offset:"4"`
+	}
+	buffer := bytes.NewBuffer(nil)
+	encoder := NewEncoder(buffer)
+	err := encoder.SetOffsetBase(1)
+	c.Assert(err, IsNil)
+	err = encoder.Encode(&record{Code: "ABC"})
+	c.Assert(err, IsNil)
+	err = encoder.Flush()
+	c.Assert(err, IsNil)
+	c.Assert(buffer.String(), Equals, "   ABC")
+}
@@ -0,0 +1,77 @@
+package fixedfield
+
+import (
+	"fmt"
+)
+
+// Convert a block of COBOL packed decimal (COMP-3) data into a signed
+// 64 bit integer.  Each byte holds two decimal digits, except the last
+// which holds one digit and a sign nibble: C or F (or the rarer A or
+// E) for positive, D (or B) for negative.
+func readPackedDecimal(block []byte) (value int64, err error) {
+	var nibble byte
+
+	if len(block) == 0 {
+		return 0, fmt.Errorf("Packed decimals must be at least 1 byte long")
+	}
+	for i := 0; i < len(block)*2-1; i++ {
+		if i%2 == 0 {
+			nibble = block[i/2] >> 4
+		} else {
+			nibble = block[i/2] & 0x0f
+		}
+		if nibble > 9 {
+			return 0, fmt.Errorf("Invalid digit nibble %X in packed decimal % X", nibble, block)
+		}
+		if value > (maxInt64-int64(nibble))/10 {
+			return 0, fmt.Errorf("Packed decimal % X overflows a 64 bit integer", block)
+		}
+		value = value*10 + int64(nibble)
+	}
+	switch block[len(block)-1] & 0x0f {
+	case 0x0c, 0x0f, 0x0a, 0x0e:
+	case 0x0d, 0x0b:
+		value = -value
+	default:
+		return 0, fmt.Errorf("Invalid sign nibble %X in packed decimal % X", block[len(block)-1]&0x0f, block)
+	}
+	return value, nil
+}
+
+// Convert a signed 64 bit integer into a block of COBOL packed decimal
+// (COMP-3) data of a known length.  Unsigned values are given an F sign
+// nibble, signed ones C or D.
+func marshalPackedDecimal(value int64, blockLength int, signed bool) (block []byte, err error) {
+	var sign, nibble byte
+	var magnitude uint64
+
+	if blockLength < 1 {
+		return nil, fmt.Errorf("Packed decimals must be at least 1 byte long")
+	}
+	sign = 0x0f
+	magnitude = uint64(value)
+	if signed {
+		sign = 0x0c
+		if value < 0 {
+			sign = 0x0d
+			magnitude = uint64(-value)
+		}
+	} else if value < 0 {
+		return nil, fmt.Errorf("Value %d cannot be written as an unsigned packed decimal", value)
+	}
+	block = make([]byte, blockLength)
+	block[blockLength-1] = sign
+	for i := blockLength*2 - 2; i >= 0; i-- {
+		nibble = byte(magnitude % 10)
+		magnitude /= 10
+		if i%2 == 0 {
+			block[i/2] |= nibble << 4
+		} else {
+			block[i/2] |= nibble
+		}
+	}
+	if magnitude != 0 {
+		return nil, fmt.Errorf("Value %d overflows a %d byte packed decimal", value, blockLength)
+	}
+	return block, nil
+}
@@ -0,0 +1,96 @@
+package fixedfield
+
+import (
+	. "launchpad.net/gocheck"
+)
+
+type PackedSuite struct{}
+
+var _ = Suite(&PackedSuite{})
+
+// Test readPackedDecimal decodes positive, negative and unsigned values.
+func (s *PackedSuite) TestReadPackedDecimal(c *C) {
+	value, err := readPackedDecimal([]byte("\x12\x34\x5c"))
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(12345))
+	value, err = readPackedDecimal([]byte("\x12\x34\x5d"))
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(-12345))
+	value, err = readPackedDecimal([]byte("\x00\x04\x2f"))
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(42))
+}
+
+// Test readPackedDecimal rejects invalid digit and sign nibbles.
+func (s *PackedSuite) TestReadPackedDecimalInvalid(c *C) {
+	_, err := readPackedDecimal([]byte("\x1a\x2c"))
+	c.Assert(err, ErrorMatches, "Invalid digit nibble A in packed decimal 1A 2C")
+	_, err = readPackedDecimal([]byte("\x12\x34"))
+	c.Assert(err, ErrorMatches, "Invalid sign nibble 4 in packed decimal 12 34")
+	_, err = readPackedDecimal([]byte("\x99\x99\x99\x99\x99\x99\x99\x99\x99\x99\x9c"))
+	c.Assert(err, ErrorMatches, ".*overflows a 64 bit integer")
+}
+
+// Test marshalPackedDecimal encodes signed and unsigned values.
+func (s *PackedSuite) TestMarshalPackedDecimal(c *C) {
+	block, err := marshalPackedDecimal(12345, 3, true)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\x12\x34\x5c"))
+	block, err = marshalPackedDecimal(-42, 3, true)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\x00\x04\x2d"))
+	block, err = marshalPackedDecimal(42, 2, false)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\x04\x2f"))
+}
+
+// Test marshalPackedDecimal refuses values that don't fit.
+func (s *PackedSuite) TestMarshalPackedDecimalOverflow(c *C) {
+	_, err := marshalPackedDecimal(1234, 2, true)
+	c.Assert(err, ErrorMatches, "Value 1234 overflows a 2 byte packed decimal")
+	_, err = marshalPackedDecimal(-1, 2, false)
+	c.Assert(err, ErrorMatches, "Value -1 cannot be written as an unsigned packed decimal")
+}
+
+// A PIC S9(7)V99 COMP-3 field round trips as an integer, a float and a
+// Decimal.
+func (s *PackedSuite) TestMarshalUnmarshalPacked(c *C) {
+	type record struct {
+		Cents   int     `length:"5" encoding:"packed"`
+		Count   uint16  `length:"2" encoding:"packed"`
+		Amount  float64 `length:"5" encoding:"packed" scale:"2"`
+		Balance Decimal `length:"5" encoding:"packed" scale:"2"`
+	}
+	data := []byte("\x00\x01\x23\x45\x6d" + "\x99\x9f" + "\x00\x01\x23\x45\x6d" + "\x12\x34\x56\x78\x9c")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Cents, Equals, -123456)
+	c.Assert(result.Count, Equals, uint16(999))
+	c.Assert(result.Amount, Equals, -1234.56)
+	c.Assert(result.Balance, Equals, Decimal{Unscaled: 123456789, Scale: 2})
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, data)
+}
+
+// Scale may only be given for fields that can hold fractions.
+func (s *PackedSuite) TestScaleOnIntegerIsRejected(c *C) {
+	type record struct {
+		Cents int `length:"5" encoding:"packed" scale:"2"`
+	}
+	_, err := buildSpecs(&record{})
+	c.Assert(err, ErrorMatches, ".*record.Cents has a scale, but only float and Decimal fields may be scaled")
+}
+
+// A packed field needs room for at least its sign nibble.
+func (s *PackedSuite) TestZeroLengthIsRejected(c *C) {
+	type record struct {
+		Amount int `length:"0" encoding:"packed"`
+	}
+	_, err := buildSpecs(&record{})
+	c.Assert(err, ErrorMatches, ".*record.Amount is packed, so must have a length of at least 1, got 0")
+
+	_, err = marshalPackedDecimal(5, 0, true)
+	c.Assert(err, ErrorMatches, "Packed decimals must be at least 1 byte long")
+}
@@ -36,6 +36,8 @@ func readBinaryInteger(block []byte, blockLength int, byteOrder binary.ByteOrder
 		}
 	case 8:
 		err = binary.Read(buffer, byteOrder, &value)
+	default:
+		err = fmt.Errorf("Binary integers must have a length of 1, 2, 4 or 8 bytes, %d bytes specified", blockLength)
 	}
 	return value, err
 }
@@ -65,6 +67,8 @@ func readBinaryUnsignedInteger(block []byte, blockLength int, byteOrder binary.B
 		}
 	case 8:
 		err = binary.Read(buffer, byteOrder, &value)
+	default:
+		err = fmt.Errorf("Binary integers must have a length of 1, 2, 4 or 8 bytes, %d bytes specified", blockLength)
 	}
 	return value, err
 }
@@ -87,12 +91,35 @@ func readASCIIInteger(block []byte) (value int64, err error) {
 	return
 }
 
+// Convert an array of ASCII chars, of a known length, into an
+// unsigned 64 bit integer.
+func readASCIIUnsignedInteger(block []byte) (value uint64, err error) {
+	return strconv.ParseUint(strings.TrimSpace(string(block)), 10, 64)
+}
+
+// Packed and zoned encodings always hold decimal numbers.
+func isDecimalEncoding(encoding string) bool {
+	switch strings.ToLower(encoding) {
+	case "packed", "zoned":
+		return true
+	}
+	return false
+}
+
+// Read the unscaled value of a packed or zoned decimal field.
+func readDecimalInteger(s spec, block []byte) (value int64, err error) {
+	if strings.ToLower(s.Encoding) == "zoned" {
+		return readZonedDecimal(block, s.Charset.isEBCDIC(), s.Sign == "leading")
+	}
+	return readPackedDecimal(block)
+}
+
 func makeUnmarshalIntegerError(s spec) error {
 	reflectType := s.StructField.Type
 	kind := reflectType.Kind()
 	typeName := kind.String()
 	name := s.StructName + "." + s.StructField.Name
-	return fmt.Errorf("Failure unmarshalling %s field '%s'. Integer fields must be annotated with an encoding type of BigEndian, LittleEndian or ASCII", typeName, name)
+	return fmt.Errorf("Failure unmarshalling %s field '%s'. Integer fields must be annotated with an encoding type of BigEndian, LittleEndian, ASCII, Packed or Zoned", typeName, name)
 }
 
 // Given a spec, a block of bytes, and a block length, populate
@@ -102,14 +129,19 @@ func readInteger(s spec, block []byte) (err error) {
 	var value int64
 	switch strings.ToLower(s.Encoding) {
 	case "ascii":
-		value, err = readASCIIInteger(block)
+		value, err = readASCIIInteger(s.Charset.decode(block))
 	case "bigendian", "be":
 		value, err = readBinaryInteger(block, s.Length, binary.BigEndian)
 	case "littleendian", "le":
 		value, err = readBinaryInteger(block, s.Length, binary.LittleEndian)
+	case "packed", "zoned":
+		value, err = readDecimalInteger(s, block)
 	default:
 		err = makeUnmarshalIntegerError(s)
 	}
+	if err == nil && s.Unit != 0 {
+		value, err = countToDuration(value, s.Unit)
+	}
 	if err == nil {
 		s.Value.SetInt(value)
 		return nil
@@ -121,18 +153,21 @@ func readInteger(s spec, block []byte) (err error) {
 // the field defined by the spec with a 64bit unsigned integer value
 // encoded in the block of bytes.
 func readUnsignedInteger(s spec, block []byte) (err error) {
-	var intVal int
 	var value uint64
 	switch strings.ToLower(s.Encoding) {
 	case "ascii":
-		intVal, err = strconv.Atoi(string(block))
-		if err == nil {
-			value = uint64(intVal)
-		}
+		value, err = readASCIIUnsignedInteger(s.Charset.decode(block))
 	case "bigendian", "be":
 		value, err = readBinaryUnsignedInteger(block, s.Length, binary.BigEndian)
 	case "littleendian", "le":
 		value, err = readBinaryUnsignedInteger(block, s.Length, binary.LittleEndian)
+	case "packed", "zoned":
+		var intVal int64
+		intVal, err = readDecimalInteger(s, block)
+		if err == nil && intVal < 0 {
+			err = fmt.Errorf("Negative %s decimal % X read into unsigned field %s", s.Encoding, block, s.StructField.Name)
+		}
+		value = uint64(intVal)
 	default:
 		err = makeUnmarshalIntegerError(s)
 	}
@@ -167,12 +202,30 @@ func readBinaryFloat(block []byte, blockLength int, byteOrder binary.ByteOrder)
 // information from the spec.
 func readFloat(s spec, block []byte, kind reflect.Kind) (err error) {
 	var f64Val float64
+	var bitSize int = 64
+	var d Decimal
+
+	if kind == reflect.Float32 {
+		bitSize = 32
+	}
+	if s.Scale != 0 || isDecimalEncoding(s.Encoding) {
+		d, err = readScaledDecimal(s, block)
+		if err == nil {
+			f64Val, err = d.float(bitSize)
+		}
+		if err == nil {
+			s.Value.SetFloat(f64Val)
+		}
+		return err
+	}
+
 	switch strings.ToLower(s.Encoding) {
 	case "ascii":
+		text := strings.TrimSpace(string(s.Charset.decode(block)))
 		if kind == reflect.Float32 {
-			f64Val, err = strconv.ParseFloat(string(block), 32)
+			f64Val, err = strconv.ParseFloat(text, 32)
 		} else {
-			f64Val, err = strconv.ParseFloat(string(block), 64)
+			f64Val, err = strconv.ParseFloat(text, 64)
 		}
 	case "bigendian", "be":
 		f64Val, err = readBinaryFloat(block, s.Length, binary.BigEndian)
@@ -201,7 +254,7 @@ func readBool(s spec, block []byte) (err error) {
 		}
 		boolVal = int(block[0]) != 0
 	case "ascii":
-		boolVal = bytes.Contains(s.TrueBytes, block)
+		boolVal = bytes.Contains(s.TrueBytes, s.Charset.decode(block))
 	default:
 		err = fmt.Errorf("Invalid encoding for a boolean value specified. %s",
 			s.String())
@@ -212,10 +265,77 @@ func readBool(s spec, block []byte) (err error) {
 	return err
 }
 
+// Read a string from a block of bytes, trimming the padding character
+// from the side(s) opposite to the field's alignment.
+func readString(s spec, block []byte) {
+	var value string = s.Charset.decodeString(block)
+	var padding string = s.Padding[:1]
+
+	if len(s.LengthFrom) != 0 {
+		// Variable length strings are never padded.
+		s.Value.SetString(value)
+		return
+	}
+	switch s.Align {
+	case "right":
+		value = strings.TrimLeft(value, padding)
+	case "center":
+		value = strings.Trim(value, padding)
+	default:
+		value = strings.TrimRight(value, padding)
+	}
+	s.Value.SetString(value)
+}
+
+// Read an exact Decimal from a block of bytes using encoding
+// information from the spec.
+func readDecimal(s spec, block []byte) (err error) {
+	var d Decimal
+
+	d, err = readScaledDecimal(s, block)
+	if err == nil {
+		s.Value.Set(reflect.ValueOf(d))
+	}
+	return err
+}
+
+// Read a number with an implied decimal point, s.Scale digits from
+// the right, from a block of bytes.  ASCII numbers that contain an
+// explicit decimal point are read as they are.
+func readScaledDecimal(s spec, block []byte) (d Decimal, err error) {
+	var text string
+
+	d.Scale = s.Scale
+	switch strings.ToLower(s.Encoding) {
+	case "ascii":
+		text = strings.TrimSpace(string(s.Charset.decode(block)))
+		d, err = ParseDecimal(text)
+		if !strings.Contains(text, ".") {
+			d.Scale = s.Scale
+		}
+	case "bigendian", "be":
+		d.Unscaled, err = readBinaryInteger(block, s.Length, binary.BigEndian)
+	case "littleendian", "le":
+		d.Unscaled, err = readBinaryInteger(block, s.Length, binary.LittleEndian)
+	case "packed", "zoned":
+		d.Unscaled, err = readDecimalInteger(s, block)
+	default:
+		err = fmt.Errorf("Invalid encoding for a decimal value specified. %s",
+			s.String())
+	}
+	return d, err
+}
+
 func populateKind(kind reflect.Kind, block []byte, s spec, data io.Reader) (err error) {
+	switch s.Value.Type() {
+	case decimalType:
+		return readDecimal(s, block)
+	case timeType:
+		return readTime(s, block)
+	}
 	switch kind {
 	case reflect.String:
-		s.Value.SetString(string(block))
+		readString(s, block)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		err = readInteger(s, block)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
@@ -234,48 +354,142 @@ func populateKind(kind reflect.Kind, block []byte, s spec, data io.Reader) (err
 // Read an array of bytes of given lengdh from the provided data.
 func readBlock(data io.Reader, length int) (block []byte, err error) {
 	var bytesRead int
+	var copied int64
+	var buffer bytes.Buffer
+
+	if length > maxPreallocatedBlock {
+		// The length may come from the data itself, so only grow
+		// the block as bytes actually arrive.
+		copied, err = io.CopyN(&buffer, data, int64(length))
+		if copied != int64(length) {
+			return nil, fmt.Errorf("Buffer underrun, %d of %d bytes read.", copied, length)
+		}
+		return buffer.Bytes(), nil
+	}
 	block = make([]byte, length)
-	bytesRead, err = data.Read(block)
+	bytesRead, err = io.ReadFull(data, block)
 	if bytesRead != length {
 		return nil, fmt.Errorf("Buffer underrun, %d of %d bytes read.", bytesRead, length)
 	}
 	return block, err
 }
 
-// Given a slice of specs and some data, populate the target
-// struct elements from the data.
-func populateStructFromSpecAndBytes(specs []spec, data io.Reader) (err error) {
+// Blocks larger than this are read without allocating all of their
+// space up front.
+const maxPreallocatedBlock = 64 * 1024
+
+// Return the length or count held by an already populated integer
+// field, for use by the spec s.
+func readCount(s spec, source spec) (count int, err error) {
+	switch source.Value.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if source.Value.Uint() > uint64(maxInt64) {
+			return 0, fmt.Errorf("Field %s.%s gives an impossible length of %d for field %s",
+				s.StructName, source.StructField.Name, source.Value.Uint(), s.StructField.Name)
+		}
+		return int(source.Value.Uint()), nil
+	}
+	if source.Value.Int() < 0 {
+		return 0, fmt.Errorf("Field %s.%s gives an impossible length of %d for field %s",
+			s.StructName, source.StructField.Name, source.Value.Int(), s.StructField.Name)
+	}
+	return int(source.Value.Int()), nil
+}
+
+// Populate a single struct element, which may be a slice or a
+// nested struct, from the data.
+func populateField(s spec, data io.Reader) (err error) {
 	var block []byte
 	var sliceType reflect.Type
 	var elemKind reflect.Kind
 
-	for _, s := range specs {
-		kind := s.Value.Kind()
+	if s.Filler {
+		_, err = readBlock(data, s.Size())
+		return err
+	}
+	kind := s.Value.Kind()
+	if s.Block {
+		block, err = readBlock(data, s.Length)
+		if err != nil {
+			return err
+		}
+		return readBytes(s, block)
+	}
+	if kind == reflect.Slice || kind == reflect.Array {
+		sliceType = s.Value.Type()
+		elemKind = sliceType.Elem().Kind()
+		if !s.Value.CanSet() {
+			return fmt.Errorf("Cannot set slice, %s", s.StructName)
+		}
 		if kind == reflect.Slice {
-			sliceType = s.Value.Type()
-			elemKind = sliceType.Elem().Kind()
-			if !s.Value.CanSet() {
-				return fmt.Errorf("Cannot set slice, %s", s.StructName)
-			}
 			s.Value.Set(
 				reflect.MakeSlice(sliceType, s.Repeat, s.Repeat))
-			sliceValue := s.Value
-			for offset := 0; offset < s.Repeat; offset++ {
-				block, err = readBlock(data, s.Length)
-				if err != nil {
-					return err
-				}
-				s.Value = sliceValue.Index(offset)
-				err = populateKind(elemKind, block, s, data)
-			}
-		} else {
+		}
+		sliceValue := s.Value
+		children := s.Children
+		for offset := 0; offset < s.Repeat; offset++ {
 			block, err = readBlock(data, s.Length)
 			if err != nil {
 				return err
 			}
-			err = populateKind(kind, block, s, data)
+			s.Value = sliceValue.Index(offset)
+			if elemKind == reflect.Struct {
+				s.Children = bindSpecs(children, s.Value)
+			}
+			err = populateKind(elemKind, block, s, data)
+			if err != nil {
+				return err
+			}
 		}
+		return nil
+	}
+	block, err = readBlock(data, s.Length)
+	if err != nil {
+		return err
+	}
+	return populateKind(kind, block, s, data)
+}
+
+// Given a slice of specs and some data, populate the target
+// struct elements from the data.  When any field has an explicit
+// offset the whole extent of the struct is read up front and each
+// field is populated from its own position within it.
+func populateStructFromSpecAndBytes(specs []spec, data io.Reader) (err error) {
+	var record []byte
+
+	if isPlaced(specs) {
+		record, err = readBlock(data, recordSize(specs))
+		if err != nil {
+			return err
+		}
+		for _, s := range specs {
+			err = populateField(s, bytes.NewReader(
+				record[s.Offset:s.Offset+fieldSize(s)]))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 
+	for _, s := range specs {
+		if len(s.LengthFrom) != 0 {
+			s.Length, err = readCount(s, specs[s.LengthIndex])
+			if err != nil {
+				return err
+			}
+		}
+		if len(s.RepeatFrom) != 0 {
+			s.Repeat, err = readCount(s, specs[s.RepeatIndex])
+			if err != nil {
+				return err
+			}
+			if s.Repeat > s.MaxRepeat {
+				return fmt.Errorf("Field %s.%s repeats %d times, but may only repeat %d times",
+					s.StructName, s.StructField.Name, s.Repeat, s.MaxRepeat)
+			}
+		}
+		err = populateField(s, data)
 		if err != nil {
 			return err
 		}
@@ -283,6 +497,9 @@ func populateStructFromSpecAndBytes(specs []spec, data io.Reader) (err error) {
 	return nil
 }
 
+// Unmarshal populates the struct pointed to by v from a single record.
+// Offset tags are always 0-based here; use a Decoder with
+// SetOffsetBase to read a 1-based layout.
 func Unmarshal(data []byte, v interface{}) (err error) {
 	var specs []spec
 
@@ -6,6 +6,7 @@ import (
 	. "launchpad.net/gocheck"
 	"math"
 	"reflect"
+	"strings"
 )
 
 
@@ -269,6 +270,14 @@ func (s *ReadSuite) TestReadASCIIIntegerNegative(c *C) {
 	c.Assert(value, Equals, int64(-4096))
 }
 
+// Test readASCIIUnsignedInteger with a space padded value
+func (s *ReadSuite) TestReadASCIIUnsignedIntegerPadded(c *C) {
+	block := []byte("   4096")
+	value, err := readASCIIUnsignedInteger(block)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, uint64(4096))
+}
+
 // Test readInteger with ASCII value
 func (s *ReadSuite) TestReadIntegerWithASCII(c *C) {
 	type testStruct struct {
@@ -727,6 +736,32 @@ func (s *ReadSuite) TestReadBoolASCII(c *C) {
 	c.Assert(target.Value, Equals, true)
 }
 
+// Test that readString trims padding from the side opposite the
+// field's alignment.
+func (s *ReadSuite) TestReadStringTrimsPadding(c *C) {
+	type testStruct struct {
+		Value string
+	}
+
+	target := &testStruct{}
+	values := reflect.ValueOf(target).Elem()
+	readspec := spec{
+		Value:       values.Field(0),
+		StructField: values.Type().Field(0),
+		Length:      7,
+		Repeat:      1,
+		Padding:     " ",
+		Align:       "left"}
+	readString(readspec, []byte(" Bob   "))
+	c.Assert(target.Value, Equals, " Bob")
+	readspec.Align = "right"
+	readString(readspec, []byte(" Bob   "))
+	c.Assert(target.Value, Equals, "Bob   ")
+	readspec.Align = "center"
+	readString(readspec, []byte(" Bob   "))
+	c.Assert(target.Value, Equals, "Bob")
+}
+
 // Test populateStructFromSpecAndBytes copies values from a
 // ReaderSeeker into the appropriate structural elements
 func (s *ReadSuite) TestPopulateStructFromSpecAndBytes(c *C) {
@@ -815,3 +850,166 @@ func (s *ReadSuite) TestUnmarshal(c *C) {
 		c.Assert(target.Ratings[i], Equals, i)
 	}
 }
+
+// Test that Unmarshal reads fields from their offsets, skipping gaps
+// and coping with fields declared out of order.
+func (s *ReadSuite) TestUnmarshalOffsets(c *C) {
+	type record struct {
+		Amount int    `length:"4" encoding:"ascii" offset:"10"`
+		Name   string `length:"5" offset:"0"`
+		Buyer  Person `offset:"15"`
+	}
+	target := &record{}
+	err := Unmarshal([]byte("Geoff.....0042.Elisa\x07"), target)
+	c.Assert(err, IsNil)
+	c.Assert(target.Name, Equals, "Geoff")
+	c.Assert(target.Amount, Equals, 42)
+	c.Assert(target.Buyer.Name, Equals, "Elisa")
+	c.Assert(target.Buyer.Age, Equals, 7)
+
+	err = Unmarshal([]byte("Geoff.....0042.Eli"), target)
+	c.Assert(err, ErrorMatches, "Buffer underrun, 18 of 21 bytes read.")
+}
+
+// Test that Unmarshal skips the bytes covered by filler fields and
+// leaves ignored and unexported fields alone.
+func (s *ReadSuite) TestUnmarshalSkipsFields(c *C) {
+	type record struct {
+		Code    string `length:"3"`
+		Derived int    `fixedfield:"-"`
+		_       string `length:"2"`
+		cache   string
+		Name    string `length:"5"`
+	}
+	target := &record{Derived: 9, cache: "kept"}
+	err := Unmarshal([]byte("ABC--Geoff"), target)
+	c.Assert(err, IsNil)
+	c.Assert(target.Code, Equals, "ABC")
+	c.Assert(target.Name, Equals, "Geoff")
+	c.Assert(target.Derived, Equals, 9)
+	c.Assert(target.cache, Equals, "kept")
+}
+
+// Test that Unmarshal reads as many bytes for a variable length field
+// as the field it refers to says.
+func (s *ReadSuite) TestUnmarshalLengthFrom(c *C) {
+	type record struct {
+		Size    uint16 `length:"2" encoding:"be"`
+		Payload string `lengthFrom:"Size"`
+		Code    string `length:"3"`
+	}
+	target := &record{}
+	err := Unmarshal([]byte("\x00\x06Geoff ABC"), target)
+	c.Assert(err, IsNil)
+	c.Assert(target.Size, Equals, uint16(6))
+	c.Assert(target.Payload, Equals, "Geoff ")
+	c.Assert(target.Code, Equals, "ABC")
+
+	err = Unmarshal([]byte("\x00\x0cGeoff ABC"), target)
+	c.Assert(err, ErrorMatches, "Buffer underrun, 9 of 12 bytes read.")
+
+	type huge struct {
+		Size    uint32 `length:"4" encoding:"be"`
+		Payload string `lengthFrom:"Size"`
+	}
+	err = Unmarshal([]byte("\xff\xff\xff\xffabc"), &huge{})
+	c.Assert(err, ErrorMatches, "Buffer underrun, 3 of 4294967295 bytes read.")
+	large := &huge{}
+	err = Unmarshal(append([]byte("\x00\x01\x11\x70"), strings.Repeat("x", 70000)...), large)
+	c.Assert(err, IsNil)
+	c.Assert(large.Payload, HasLen, 70000)
+
+	type signed struct {
+		Size    int    `length:"2" encoding:"ascii"`
+		Payload string `lengthFrom:"Size"`
+	}
+	err = Unmarshal([]byte("-1"), &signed{})
+	c.Assert(err, ErrorMatches, "Field .*Size gives an impossible length of -1 for field Payload")
+}
+
+// Test that Unmarshal makes a slice with as many elements as the
+// field it refers to says, up to its maxRepeat.
+func (s *ReadSuite) TestUnmarshalRepeatFrom(c *C) {
+	type record struct {
+		Count int    `length:"2" encoding:"ascii"`
+		Items []int  `length:"3" encoding:"ascii" repeatFrom:"Count" maxRepeat:"3"`
+		Code  string `length:"3"`
+	}
+	target := &record{}
+	err := Unmarshal([]byte("02001002ABC"), target)
+	c.Assert(err, IsNil)
+	c.Assert(target.Items, DeepEquals, []int{1, 2})
+	c.Assert(target.Code, Equals, "ABC")
+
+	err = Unmarshal([]byte("00ABC"), target)
+	c.Assert(err, IsNil)
+	c.Assert(target.Items, HasLen, 0)
+	c.Assert(target.Code, Equals, "ABC")
+
+	err = Unmarshal([]byte("04001002003004ABC"), target)
+	c.Assert(err, ErrorMatches, "Field .*Items repeats 4 times, but may only repeat 3 times")
+
+	type uncapped struct {
+		Count uint32 `length:"4" encoding:"be"`
+		Items []int  `length:"1" encoding:"ascii" repeatFrom:"Count"`
+	}
+	err = Unmarshal([]byte("\xff\xff\xff\xff123"), &uncapped{})
+	c.Assert(err, ErrorMatches, "Field .*Items repeats 4294967295 times, but may only repeat 10000 times")
+}
+
+// Test that Unmarshal populates each element of a slice of structs.
+func (s *ReadSuite) TestUnmarshalSliceOfStructs(c *C) {
+	type record struct {
+		People []Person `repeat:"2"`
+		Count  int      `length:"1" encoding:"ascii"`
+		Others []Person `repeatFrom:"Count"`
+	}
+	target := &record{}
+	err := Unmarshal([]byte("Geoff\x25Elisa\x041Alan \x07"), target)
+	c.Assert(err, IsNil)
+	c.Assert(target.People, DeepEquals, []Person{{"Geoff", 37}, {"Elisa", 4}})
+	c.Assert(target.Others, DeepEquals, []Person{{"Alan", 7}})
+}
+
+// Test that Unmarshal populates every element of an array.
+func (s *ReadSuite) TestUnmarshalArrays(c *C) {
+	type record struct {
+		Ratings [3]int `length:"1" encoding:"ascii"`
+		Flags   [2]byte
+		People  [2]Person
+	}
+	target := &record{}
+	err := Unmarshal([]byte("123\x01\x02Geoff\x25Elisa\x04"), target)
+	c.Assert(err, IsNil)
+	c.Assert(target.Ratings, Equals, [3]int{1, 2, 3})
+	c.Assert(target.Flags, Equals, [2]byte{1, 2})
+	c.Assert(target.People, Equals, [2]Person{{"Geoff", 37}, {"Elisa", 4}})
+}
+
+// Test that binary integers of an unsupported length are an error,
+// rather than silently read as zero.
+func (s *ReadSuite) TestReadBinaryIntegerInvalidLength(c *C) {
+	_, err := readBinaryInteger([]byte("abc"), 3, binary.BigEndian)
+	c.Assert(err, ErrorMatches, "Binary integers must have a length of 1, 2, 4 or 8 bytes, 3 bytes specified")
+	_, err = readBinaryUnsignedInteger([]byte("abc"), 3, binary.BigEndian)
+	c.Assert(err, ErrorMatches, "Binary integers must have a length of 1, 2, 4 or 8 bytes, 3 bytes specified")
+}
+
+func (s *ReadSuite) BenchmarkUnmarshal(c *C) {
+	data := []byte("Geoff" +
+		"          36" +
+		"\x00\x7f" +
+		"\x7f\x00" +
+		"\xff\xff\xff\xff\xff\xff\xff\xff" +
+		"001.23" +
+		"\x18\x2d\x44\x54\xfb\x21\x09\x40" +
+		"\x40\x49\x0f\xdb" +
+		"\x00" +
+		"\x59" +
+		"J" +
+		"0123456789")
+	target := &Target{}
+	for i := 0; i < c.N; i++ {
+		Unmarshal(data, target)
+	}
+}
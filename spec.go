@@ -3,7 +3,11 @@ package fixedfield
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // A spec is created, by buildSpecs, for each field in a
@@ -16,9 +20,34 @@ type spec struct {
 	StructField reflect.StructField
 	Length      int
 	Repeat      int
+	LengthFrom  string
+	LengthIndex int
+	RepeatFrom  string
+	RepeatIndex int
+	MaxRepeat   int
+	Offset      int
+	Placed      bool
+	Filler      bool
+	Block       bool
+	Fill        string
 	Encoding    string
 	Padding     string
+	Align       string
+	Truncate    bool
+	Precision   int
+	Scale       int
+	Sign        string
+	Rounding    string
+	Layout      string
+	Julian      string
+	Location    *time.Location
+	Zero        string
+	Epoch       string
+	Unit        time.Duration
+	Charset     *charset
+	BaseCharset *charset
 	TrueBytes   []byte
+	FalseBytes  []byte
 	Children    []spec
 }
 
@@ -31,25 +60,108 @@ func (s *spec) String() string {
 			"Repeat %d\n"+
 			"Encoding %s\n"+
 			"TrueBytes %s\n"+
+			"FalseBytes %s\n"+
 			"Children %v\n",
 		s.StructField.Name, s.Value.Interface(), s.Length, s.Repeat,
-		s.Encoding, string(s.TrueBytes), s.Children)
+		s.Encoding, string(s.TrueBytes), string(s.FalseBytes), s.Children)
 }
 
 func (s *spec) Size() int {
 	return s.Length * s.Repeat
 }
 
+// Return the number of bytes occupied by a single field, including
+// any nested structure.
+func fieldSize(s spec) int {
+	if s.Children != nil {
+		if isRepeated(s.StructField.Type) {
+			return recordSize(s.Children) * s.Repeat
+		}
+		return recordSize(s.Children)
+	}
+	return s.Size()
+}
+
+// Return the total number of bytes occupied by a record described by
+// the given specs, including any nested structures and any gaps left
+// between positioned fields.
+func recordSize(specs []spec) (size int) {
+	for _, s := range specs {
+		if s.Offset+fieldSize(s) > size {
+			size = s.Offset + fieldSize(s)
+		}
+	}
+	return size
+}
+
+// Return true if the size of any of the specs, or of their children,
+// is only known once the record is read or written.
+func isVariable(specs []spec) bool {
+	for _, s := range specs {
+		if len(s.LengthFrom) != 0 || len(s.RepeatFrom) != 0 || isVariable(s.Children) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return true if any of the specs has an explicit offset, in which
+// case the fields can't simply be read and written in order.
+func isPlaced(specs []spec) bool {
+	for _, s := range specs {
+		if s.Placed {
+			return true
+		}
+	}
+	return false
+}
+
 
+// Strings and ASCII numbers are padded with spaces, unless a padding
+// tag says otherwise.
 func getPadding(tag reflect.StructTag) string {
 	var padding string
 	padding = tag.Get("padding")
 	if len(padding) == 0 {
-		padding = "0"
+		padding = " "
 	}
 	return padding
 }
 
+// Filler fields are filled with spaces unless told otherwise.
+func getFieldFill(tag reflect.StructTag) string {
+	var fill string
+
+	fill = tag.Get("fill")
+	if len(fill) == 0 {
+		return " "
+	}
+	return fill
+}
+
+func getFieldAlign(tag reflect.StructTag) (string, error) {
+	var align string
+
+	align = strings.ToLower(tag.Get("align"))
+	switch align {
+	case "":
+		return "left", nil
+	case "left", "right", "center":
+		return align, nil
+	}
+	return "", fmt.Errorf("Invalid align tag '%s', must be one of left, right or center", align)
+}
+
+func getFieldTruncate(tag reflect.StructTag) (bool, error) {
+	var truncate string
+
+	truncate = tag.Get("truncate")
+	if len(truncate) == 0 {
+		return false, nil
+	}
+	return strconv.ParseBool(truncate)
+}
+
 func getFieldLength(tag reflect.StructTag) (int, error) {
 	var tagLength string
 	tagLength = tag.Get("length")
@@ -69,6 +181,98 @@ func getFieldRepeat(tag reflect.StructTag) (int, error) {
 	return strconv.Atoi(repeat)
 }
 
+// Return the 0-based offset of a field, given the base in which the
+// offset tag is written.
+func getFieldOffset(tag reflect.StructTag, base int) (offset int, placed bool, err error) {
+	var tagOffset string
+
+	tagOffset = tag.Get("offset")
+	if len(tagOffset) == 0 {
+		return 0, false, nil
+	}
+	offset, err = strconv.Atoi(tagOffset)
+	if err != nil {
+		return 0, false, err
+	}
+	if offset < base {
+		return 0, false, fmt.Errorf("Invalid offset tag '%s', offsets are %d-based", tagOffset, base)
+	}
+	return offset - base, true, nil
+}
+
+// Variable repeat counts come from the data, so are capped at
+// defaultMaxRepeat unless a maxRepeat tag gives another limit.
+const defaultMaxRepeat = 10000
+
+func getFieldMaxRepeat(tag reflect.StructTag) (int, error) {
+	var maxRepeat string
+	var value int
+	var err error
+
+	maxRepeat = tag.Get("maxRepeat")
+	if len(maxRepeat) == 0 {
+		return defaultMaxRepeat, nil
+	}
+	value, err = strconv.Atoi(maxRepeat)
+	if err == nil && value < 1 {
+		return 0, fmt.Errorf("Invalid maxRepeat tag '%s', must be at least 1", maxRepeat)
+	}
+	return value, err
+}
+
+// The number of decimal places to write for an ASCII float.  A
+// negative precision means "as many as will fit".
+func getFieldPrecision(tag reflect.StructTag) (int, error) {
+	var precision string
+
+	precision = tag.Get("precision")
+	if len(precision) == 0 {
+		return -1, nil
+	}
+	return strconv.Atoi(precision)
+}
+
+// The number of implied decimal places in a numeric field.
+func getFieldScale(tag reflect.StructTag) (int, error) {
+	var scale string
+
+	scale = tag.Get("scale")
+	if len(scale) == 0 {
+		return 0, nil
+	}
+	return strconv.Atoi(scale)
+}
+
+// Where the sign of a zoned decimal is overpunched.
+func getFieldSign(tag reflect.StructTag) (string, error) {
+	var sign string
+
+	sign = strings.ToLower(tag.Get("sign"))
+	switch sign {
+	case "":
+		return "trailing", nil
+	case "leading", "trailing":
+		return sign, nil
+	}
+	return "", fmt.Errorf("Invalid sign tag '%s', must be one of leading or trailing", sign)
+}
+
+// How digits beyond a field's scale are discarded when writing it.
+func getFieldRounding(tag reflect.StructTag) (string, error) {
+	var rounding string
+
+	rounding = strings.ToLower(tag.Get("rounding"))
+	if len(rounding) == 0 {
+		return "", nil
+	}
+	for _, mode := range roundingModes {
+		if rounding == mode {
+			return rounding, nil
+		}
+	}
+	return "", fmt.Errorf("Invalid rounding tag '%s', must be one of %s", rounding, strings.Join(roundingModes, ", "))
+}
+
 func getFieldEncoding(tag reflect.StructTag) string {
 	var encoding string
 
@@ -90,12 +294,170 @@ func getFieldTrueBytes(tag reflect.StructTag) []byte {
 	return []byte(trueChars)
 }
 
-func buildSpecFromField(value reflect.Value, field reflect.StructField, structName string) (s spec, err error) {
+func getFieldFalseBytes(tag reflect.StructTag) []byte {
+	var falseChars string
+
+	falseChars = tag.Get("falseChars")
+
+	if len(falseChars) == 0 {
+		return []byte("N")
+	}
+	return []byte(falseChars)
+}
+
+func getFieldCharset(tag reflect.StructTag) (*charset, error) {
+	var name string
+
+	name = tag.Get("charset")
+	if len(name) == 0 {
+		return nil, nil
+	}
+	return lookupCharset(name)
+}
+
+// The unit of a duration field, nanoseconds if none is given.
+func getFieldUnit(tag reflect.StructTag, fieldType reflect.Type) (time.Duration, error) {
+	var unit string = tag.Get("unit")
+	var duration time.Duration
+	var ok bool
+
+	if elemType(fieldType) != durationType {
+		if unit != "" {
+			return 0, fmt.Errorf("Only time.Duration fields may have a unit tag")
+		}
+		return 0, nil
+	}
+	if unit == "" {
+		return time.Nanosecond, nil
+	}
+	duration, ok = durationUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("Invalid unit tag '%s', must be one of ns, us, ms, s, m or h", unit)
+	}
+	return duration, nil
+}
+
+// Read the tags that describe how a time is laid out.  Times must
+// have a layout tag, holding a Go reference layout, a julian tag, or,
+// for binary times, an epoch tag.  If no length is given then it is
+// taken from the layout, or is 8 bytes for binary times (4 for DOS
+// times).
+func getTimeLayout(s *spec, tag reflect.StructTag) (err error) {
+	var ok bool
+
+	s.Location = time.UTC
+	if tag.Get("tz") != "" {
+		s.Location, err = time.LoadLocation(tag.Get("tz"))
+		if err != nil {
+			return err
+		}
+	}
+
+	s.Zero = strings.ToLower(tag.Get("zero"))
+	switch s.Zero {
+	case "", "zeros", "blanks":
+	default:
+		return fmt.Errorf("Invalid zero tag '%s', must be one of zeros or blanks", s.Zero)
+	}
+
+	s.Epoch = strings.ToLower(tag.Get("epoch"))
+	if s.Epoch != "" {
+		switch s.Epoch {
+		case "unix", "unixms", "unixns", "filetime":
+			if tag.Get("length") == "" {
+				s.Length = 8
+			}
+			if s.Length != 1 && s.Length != 2 && s.Length != 4 && s.Length != 8 {
+				return fmt.Errorf("Invalid length %d for a %s time, must be 1, 2, 4 or 8", s.Length, s.Epoch)
+			}
+		case "dos":
+			if tag.Get("length") == "" {
+				s.Length = 4
+			}
+			if s.Length != 2 && s.Length != 4 {
+				return fmt.Errorf("Invalid length %d for a dos time, must be 2 or 4", s.Length)
+			}
+		default:
+			return fmt.Errorf("Invalid epoch tag '%s', must be one of unix, unixms, unixns, dos or filetime", s.Epoch)
+		}
+		return nil
+	}
+
+	s.Layout = tag.Get("layout")
+	s.Julian = strings.ToLower(tag.Get("julian"))
+	if s.Julian != "" {
+		s.Layout, ok = julianLayouts[s.Julian]
+		if !ok {
+			return fmt.Errorf("Invalid julian tag '%s', must be one of yyddd, yyyyddd or cyyddd", s.Julian)
+		}
+	}
+	if s.Layout == "" && s.Julian == "" {
+		return fmt.Errorf("Field %s.%s is a time, but has no layout, julian or epoch tag", s.StructName, s.StructField.Name)
+	}
+	if tag.Get("length") == "" {
+		s.Length = len(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Format(s.Layout))
+		if s.Julian == "cyyddd" {
+			s.Length = 6
+		}
+	}
+	return nil
+}
+
+// A byte field is a single block.  The length of a byte array
+// defaults to the space needed to hold all of its bytes, and may not
+// be any less.
+func getBytesLength(s *spec, tag reflect.StructTag) error {
+	var size int
+
+	s.Repeat = 1
+	if s.StructField.Type.Kind() != reflect.Array {
+		return nil
+	}
+	size = encodedBytesLen(s.Encoding, s.StructField.Type.Len())
+	if len(tag.Get("length")) == 0 {
+		s.Length = size
+	} else if s.Length < size {
+		return fmt.Errorf("Field %s.%s has a length of %d, but needs %d bytes",
+			s.StructName, s.StructField.Name, s.Length, size)
+	}
+	return nil
+}
+
+// Return the type of the individual values held by a field, i.e. the
+// element type of a slice field.
+func elemType(fieldType reflect.Type) reflect.Type {
+	if isRepeated(fieldType) {
+		return fieldType.Elem()
+	}
+	return fieldType
+}
+
+// Slices and arrays are both written as a repeated element.
+func isRepeated(fieldType reflect.Type) bool {
+	return fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array
+}
+
+// Is this a nested structure, rather than a struct type that is
+// treated as a single value?
+func isNestedStruct(fieldType reflect.Type) bool {
+	return fieldType.Kind() == reflect.Struct && fieldType != decimalType && fieldType != timeType
+}
+
+// Only fields that can hold a fractional value may be scaled.
+func canScale(fieldType reflect.Type) bool {
+	fieldType = elemType(fieldType)
+	switch fieldType.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return true
+	}
+	return fieldType == decimalType
+}
+
+func buildSpecFromField(field reflect.StructField, structName string) (s spec, err error) {
 	var tag reflect.StructTag
 
 	s = spec{}
 	s.StructName = structName
-	s.Value = value
 	s.StructField = field
 	tag = s.StructField.Tag
 
@@ -108,53 +470,317 @@ func buildSpecFromField(value reflect.Value, field reflect.StructField, structNa
 	if err != nil {
 		return s, err
 	}
+	if field.Type.Kind() == reflect.Array && !isBlock(field.Type, tag) {
+		// The array length is the repeat count.
+		if len(tag.Get("repeat")) != 0 && s.Repeat != field.Type.Len() {
+			return s, fmt.Errorf("Field %s.%s has a repeat of %d, but is an array of length %d",
+				structName, field.Name, s.Repeat, field.Type.Len())
+		}
+		s.Repeat = field.Type.Len()
+	}
+
+	s.Precision, err = getFieldPrecision(tag)
+	if err != nil {
+		return s, err
+	}
+
+	s.Scale, err = getFieldScale(tag)
+	if err != nil {
+		return s, err
+	}
+	if s.Scale != 0 && !canScale(field.Type) {
+		return s, fmt.Errorf("Field %s.%s has a scale, but only float and Decimal fields may be scaled",
+			structName, field.Name)
+	}
+
+	s.Sign, err = getFieldSign(tag)
+	if err != nil {
+		return s, err
+	}
+
+	s.Rounding, err = getFieldRounding(tag)
+	if err != nil {
+		return s, err
+	}
 
 	s.Encoding = getFieldEncoding(tag)
+	if isDecimalEncoding(s.Encoding) && s.Length < 1 {
+		return s, fmt.Errorf("Field %s.%s is %s, so must have a length of at least 1, got %d",
+			structName, field.Name, strings.ToLower(s.Encoding), s.Length)
+	}
+	s.Block = isBlock(field.Type, tag)
+	if s.Block {
+		err = getBytesLength(&s, tag)
+		if err != nil {
+			return s, err
+		}
+	}
 	s.TrueBytes = getFieldTrueBytes(tag)
+	s.FalseBytes = getFieldFalseBytes(tag)
 	s.Padding = getPadding(tag)
+
+	s.Align, err = getFieldAlign(tag)
+	if err != nil {
+		return s, err
+	}
+
+	s.Truncate, err = getFieldTruncate(tag)
+	if err != nil {
+		return s, err
+	}
+
+	s.Unit, err = getFieldUnit(tag, field.Type)
+	if err != nil {
+		return s, err
+	}
+
+	if elemType(field.Type) == timeType {
+		err = getTimeLayout(&s, tag)
+		if err != nil {
+			return s, err
+		}
+	}
+
+	s.Charset, err = getFieldCharset(tag)
 	return s, err
 }
 
-func buildSpecsFromStructValue(value reflect.Value, structName string) (specs []spec, err error) {
+// Return the index of the spec for an earlier integer field that gives
+// the length or count of the spec s.
+func findCountField(specs []spec, s spec, name string) (int, error) {
+	for i, sibling := range specs {
+		if sibling.StructField.Name != name {
+			continue
+		}
+		switch sibling.StructField.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if sibling.StructField.Type != durationType && sibling.Children == nil {
+				return i, nil
+			}
+		}
+		break
+	}
+	return 0, fmt.Errorf("Field %s.%s refers to %q, which must be an earlier integer field",
+		s.StructName, s.StructField.Name, name)
+}
+
+// Return true if a struct field should have no part in the layout.
+// Fields tagged with fixedfield:"-" are ignored, as are unexported
+// fields, except for blank fields, which are used as fillers.
+func isIgnored(field reflect.StructField) bool {
+	if field.Tag.Get("fixedfield") == "-" {
+		return true
+	}
+	return len(field.PkgPath) != 0 && field.Name != "_"
+}
+
+// Options that change the layout built from a struct type, and so
+// form part of the key under which the layout is cached.
+type layoutOptions struct {
+	offsetBase int
+}
+
+// Check that no two fields of a struct occupy the same bytes.
+func checkOverlaps(specs []spec, structName string, options layoutOptions) error {
+	var ordered []spec
+
+	for _, s := range specs {
+		if fieldSize(s) > 0 {
+			ordered = append(ordered, s)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Offset < ordered[j].Offset
+	})
+	for i := 1; i < len(ordered); i++ {
+		previous, current := ordered[i-1], ordered[i]
+		if previous.Offset+fieldSize(previous) > current.Offset {
+			return fmt.Errorf("Field %s.%s (bytes %d-%d) overlaps field %s.%s (bytes %d-%d)",
+				structName, previous.StructField.Name,
+				previous.Offset+options.offsetBase,
+				previous.Offset+fieldSize(previous)-1+options.offsetBase,
+				structName, current.StructField.Name,
+				current.Offset+options.offsetBase,
+				current.Offset+fieldSize(current)-1+options.offsetBase)
+		}
+	}
+	return nil
+}
+
+// Build the specs for a struct type.  The resulting specs describe
+// the layout of the type only, and must be bound to a value, with
+// bindSpecs, before they can be used.  Fields without an offset tag
+// follow on directly from the field declared before them.
+func buildSpecsFromStructType(structType reflect.Type, structName string, options layoutOptions) (specs []spec, err error) {
 	var fieldCount int
 	var s spec
 	var subStructName string
+	var next int
 
-	fieldCount = value.NumField()
-	specs = make([]spec, fieldCount)
+	fieldCount = structType.NumField()
+	specs = make([]spec, 0, fieldCount)
 
 	for i := 0; i < fieldCount; i++ {
-		s, err = buildSpecFromField(value.Field(i), value.Type().Field(i), structName)
+		if isIgnored(structType.Field(i)) {
+			continue
+		}
+		s, err = buildSpecFromField(structType.Field(i), structName)
 		if err != nil {
 			return nil, err
 		}
-		if s.Value.Kind() == reflect.Struct {
+		if s.StructField.Name == "_" {
+			s.Filler = true
+			s.Fill = getFieldFill(s.StructField.Tag)
+		} else if length := s.StructField.Tag.Get("lengthFrom"); len(length) != 0 {
+			if s.StructField.Type.Kind() != reflect.String && !(s.Block && s.StructField.Type.Kind() == reflect.Slice) {
+				return nil, fmt.Errorf("Field %s.%s has a lengthFrom tag, but only string and byte slice fields may have a variable length",
+					structName, s.StructField.Name)
+			}
+			s.LengthFrom = length
+			s.LengthIndex, err = findCountField(specs, s, length)
+			if err != nil {
+				return nil, err
+			}
+			s.Length = 0
+		} else if isNestedStruct(s.StructField.Type) {
 			s.Length = 0
 			s.Repeat = 0
-			subStructName = s.Value.Type().String()
-			s.Children, err = buildSpecsFromStructValue(
-				s.Value, subStructName)
+			subStructName = s.StructField.Type.String()
+			s.Children, err = buildSpecsFromStructType(
+				s.StructField.Type, subStructName, options)
+			if err != nil {
+				return nil, err
+			}
+		} else if isRepeated(s.StructField.Type) && isNestedStruct(elemType(s.StructField.Type)) {
+			// Each element is a group of fields, so the length
+			// comes from the children.
+			s.Length = 0
+			subStructName = elemType(s.StructField.Type).String()
+			s.Children, err = buildSpecsFromStructType(
+				elemType(s.StructField.Type), subStructName, options)
 			if err != nil {
 				return nil, err
 			}
 		}
-		specs[i] = s
+		s.MaxRepeat, err = getFieldMaxRepeat(s.StructField.Tag)
+		if err != nil {
+			return nil, err
+		}
+		if repeat := s.StructField.Tag.Get("repeatFrom"); len(repeat) != 0 {
+			if s.StructField.Type.Kind() != reflect.Slice {
+				return nil, fmt.Errorf("Field %s.%s has a repeatFrom tag, but only slices may repeat",
+					structName, s.StructField.Name)
+			}
+			s.RepeatFrom = repeat
+			s.RepeatIndex, err = findCountField(specs, s, repeat)
+			if err != nil {
+				return nil, err
+			}
+			s.Repeat = 0
+		} else if len(s.StructField.Tag.Get("maxRepeat")) != 0 {
+			return nil, fmt.Errorf("Field %s.%s has a maxRepeat tag, but no repeatFrom tag",
+				structName, s.StructField.Name)
+		}
+		s.Offset, s.Placed, err = getFieldOffset(s.StructField.Tag, options.offsetBase)
+		if err != nil {
+			return nil, err
+		}
+		if !s.Placed {
+			s.Offset = next
+		}
+		next = s.Offset + fieldSize(s)
+		specs = append(specs, s)
+	}
+	if isPlaced(specs) {
+		if isVariable(specs) {
+			return nil, fmt.Errorf("Struct %s has fields of variable length, so can't use offset tags",
+				structName)
+		}
+		err = checkOverlaps(specs, structName, options)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return specs, nil
 }
 
+// The key under which a layout is cached.
+type specKey struct {
+	structType reflect.Type
+	options    layoutOptions
+}
+
+// Specs are expensive to build, so we build them once per type and
+// set of options, and keep them here.  Maps specKey to []spec.
+var specCache sync.Map
+
+// Return the specs for a type, building them only if they aren't
+// already cached.
+func cachedSpecs(structType reflect.Type, options layoutOptions) (specs []spec, err error) {
+	var cached interface{}
+	var ok bool
+	var key specKey = specKey{structType, options}
+
+	cached, ok = specCache.Load(key)
+	if ok {
+		return cached.([]spec), nil
+	}
+	specs, err = buildSpecsFromStructType(structType.Elem(), structType.String(), options)
+	if err != nil {
+		return nil, err
+	}
+	cached, _ = specCache.LoadOrStore(key, specs)
+	return cached.([]spec), nil
+}
+
+// Copy a slice of specs, binding each one to the corresponding field
+// of the given struct value.  The children of a slice of structs are
+// copied but left unbound, as they must be bound to each element in
+// turn.  Likewise, passing an invalid value copies the specs without
+// binding them.
+func bindSpecs(templates []spec, value reflect.Value) (specs []spec) {
+	if templates == nil {
+		return nil
+	}
+	specs = make([]spec, len(templates))
+	for i, s := range templates {
+		if s.Filler || !value.IsValid() {
+			s.Children = bindSpecs(s.Children, reflect.Value{})
+			specs[i] = s
+			continue
+		}
+		s.Value = value.Field(s.StructField.Index[0])
+		if s.Children != nil && isRepeated(s.Value.Type()) {
+			s.Children = bindSpecs(s.Children, reflect.Value{})
+		} else if s.Children != nil {
+			s.Children = bindSpecs(s.Children, s.Value)
+		}
+		specs[i] = s
+	}
+	return specs
+}
+
 // Convert annotation on a structure into a specification for what
 // should be read from a fixed field file.
 func buildSpecs(structure interface{}) (specs []spec, err error) {
-	var structValue, value reflect.Value
+	return buildSpecsWithOptions(structure, layoutOptions{})
+}
+
+// As buildSpecs, but with non-default layout options.
+func buildSpecsWithOptions(structure interface{}, options layoutOptions) (specs []spec, err error) {
+	var structValue reflect.Value
 	var structType reflect.Type
-	var structName string
 
 	structValue = reflect.ValueOf(structure)
 	structType = reflect.TypeOf(structure)
-	structName = structType.String()
+	if structValue.Kind() != reflect.Ptr || structValue.IsNil() || structType.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Expected a non-nil pointer to a struct, got %v", structType)
+	}
 
-	value = structValue.Elem()
-	specs, err = buildSpecsFromStructValue(value, structName)
-	return specs, nil
+	specs, err = cachedSpecs(structType, options)
+	if err != nil {
+		return nil, err
+	}
+	return bindSpecs(specs, structValue.Elem()), nil
 }
@@ -2,6 +2,7 @@ package fixedfield
 
 import (
 	. "launchpad.net/gocheck"
+	"reflect"
 )
 
 
@@ -22,6 +23,9 @@ func (s *SpecSuite) TestBuildReadSpecs(c *C) {
 	c.Assert(spec.StructField.Name, Equals, "Name")
 	c.Assert(spec.Length, Equals, 5)
 	c.Assert(spec.Repeat, Equals, 1)
+	c.Assert(spec.Padding, Equals, " ")
+	c.Assert(spec.Align, Equals, "left")
+	c.Assert(spec.Truncate, Equals, false)
 	spec = result[1]
 	c.Assert(spec.StructField.Name, Equals, "Age")
 	c.Assert(spec.Length, Equals, 12)
@@ -33,6 +37,7 @@ func (s *SpecSuite) TestBuildReadSpecs(c *C) {
 	c.Assert(spec.Length, Equals, 2)
 	c.Assert(spec.Repeat, Equals, 1)
 	c.Assert(spec.Encoding, Equals, "bigendian")
+	c.Assert(spec.Padding, Equals, " ")
 	spec = result[3]
 	c.Assert(spec.StructField.Name, Equals, "CollarSize")
 	c.Assert(spec.Length, Equals, 2)
@@ -75,6 +80,7 @@ func (s *SpecSuite) TestBuildReadSpecs(c *C) {
 	c.Assert(spec.Repeat, Equals, 1)
 	c.Assert(spec.Encoding, Equals, "ascii")
 	c.Assert(string(spec.TrueBytes), Equals, "jJ")
+	c.Assert(string(spec.FalseBytes), Equals, "N")
 	spec = result[11]
 	c.Assert(spec.StructField.Name, Equals, "Ratings")
 	c.Assert(spec.Length, Equals, 1)
@@ -118,4 +124,271 @@ func (s *SpecSuite) TestBuildReadSpecsWithNestedStructs(c *C) {
 	c.Assert(childSpec.StructField.Name, Equals, "Age")
 }
 
+// Test that buildSpecs rejects an unknown alignment.
+func (s *SpecSuite) TestBuildSpecsInvalidAlign(c *C) {
+	type target struct {
+		Value string `length:"3" align:"middle"`
+	}
+	_, err := buildSpecs(&target{})
+	c.Assert(err, ErrorMatches, "Invalid align tag 'middle'.*")
+}
+
+// Test that recordSize includes repeats and nested structures.
+func (s *SpecSuite) TestRecordSize(c *C) {
+	specs, err := buildSpecs(&Target{})
+	c.Assert(err, IsNil)
+	c.Assert(recordSize(specs), Equals, 60)
+	specs, err = buildSpecs(&Transaction{})
+	c.Assert(err, IsNil)
+	c.Assert(recordSize(specs), Equals, 12)
+}
+
+// Test that offsets are resolved for every field, and that fields
+// without an offset tag follow on from the one before them.
+func (s *SpecSuite) TestBuildSpecsOffsets(c *C) {
+	type record struct {
+		Code   string `length:"3" offset:"10"`
+		Name   string `length:"5"`
+		Amount int    `length:"4" encoding:"ascii" offset:"2"`
+	}
+	specs, err := buildSpecs(&record{})
+	c.Assert(err, IsNil)
+	c.Assert(specs[0].Offset, Equals, 10)
+	c.Assert(specs[0].Placed, Equals, true)
+	c.Assert(specs[1].Offset, Equals, 13)
+	c.Assert(specs[1].Placed, Equals, false)
+	c.Assert(specs[2].Offset, Equals, 2)
+	c.Assert(recordSize(specs), Equals, 18)
+
+	specs, err = buildSpecsWithOptions(&record{}, layoutOptions{offsetBase: 1})
+	c.Assert(err, IsNil)
+	c.Assert(specs[0].Offset, Equals, 9)
+	c.Assert(specs[1].Offset, Equals, 12)
+	c.Assert(specs[2].Offset, Equals, 1)
+}
+
+// Test that buildSpecs reports fields that overlap as a layout error.
+func (s *SpecSuite) TestBuildSpecsOverlappingOffsets(c *C) {
+	type record struct {
+		Code string `length:"3"`
+		Name string `length:"5" offset:"2"`
+	}
+	_, err := buildSpecs(&record{})
+	c.Assert(err, ErrorMatches,
+		"Field \\*fixedfield.record.Code \\(bytes 0-2\\) overlaps field \\*fixedfield.record.Name \\(bytes 2-6\\)")
+	_, err = buildSpecsWithOptions(&record{}, layoutOptions{offsetBase: 1})
+	c.Assert(err, ErrorMatches,
+		".*Code \\(bytes 1-3\\) overlaps .*Name \\(bytes 2-6\\)")
+}
 
+// Test that an offset before the start of the record is rejected.
+func (s *SpecSuite) TestBuildSpecsInvalidOffset(c *C) {
+	type record struct {
+		Code string `length:"3" offset:"0"`
+	}
+	_, err := buildSpecsWithOptions(&record{}, layoutOptions{offsetBase: 1})
+	c.Assert(err, ErrorMatches, "Invalid offset tag '0', offsets are 1-based")
+	type notNumber struct {
+		Code string `length:"3" offset:"first"`
+	}
+	_, err = buildSpecs(&notNumber{})
+	c.Assert(err, NotNil)
+}
+
+// Test that ignored and unexported fields have no spec, and that
+// blank fields become fillers.
+func (s *SpecSuite) TestBuildSpecsSkipsFields(c *C) {
+	type record struct {
+		Code    string `length:"3"`
+		Derived int    `fixedfield:"-"`
+		_       string `length:"2" fill:"*"`
+		cache   map[string]int
+		Name    string `length:"5"`
+	}
+	specs, err := buildSpecs(&record{})
+	c.Assert(err, IsNil)
+	c.Assert(specs, HasLen, 3)
+	c.Assert(specs[0].StructField.Name, Equals, "Code")
+	c.Assert(specs[1].Filler, Equals, true)
+	c.Assert(specs[1].Fill, Equals, "*")
+	c.Assert(specs[1].Offset, Equals, 3)
+	c.Assert(specs[2].StructField.Name, Equals, "Name")
+	c.Assert(specs[2].Offset, Equals, 5)
+	c.Assert(recordSize(specs), Equals, 10)
+}
+
+// Test that lengthFrom must name an earlier integer field, and may
+// only be used on strings outside of positioned structs.
+func (s *SpecSuite) TestBuildSpecsLengthFrom(c *C) {
+	type record struct {
+		Size    uint16 `length:"2" encoding:"be"`
+		Payload string `lengthFrom:"Size"`
+	}
+	specs, err := buildSpecs(&record{})
+	c.Assert(err, IsNil)
+	c.Assert(specs[1].LengthFrom, Equals, "Size")
+	c.Assert(specs[1].LengthIndex, Equals, 0)
+	c.Assert(isVariable(specs), Equals, true)
+	c.Assert(recordSize(specs), Equals, 2)
+
+	type later struct {
+		Payload string `lengthFrom:"Size"`
+		Size    uint16 `length:"2" encoding:"be"`
+	}
+	_, err = buildSpecs(&later{})
+	c.Assert(err, ErrorMatches, ".*Payload refers to \"Size\", which must be an earlier integer field")
+
+	type notInteger struct {
+		Size    string `length:"2"`
+		Payload string `lengthFrom:"Size"`
+	}
+	_, err = buildSpecs(&notInteger{})
+	c.Assert(err, ErrorMatches, ".*Payload refers to \"Size\", which must be an earlier integer field")
+
+	type notString struct {
+		Size    uint16  `length:"2" encoding:"be"`
+		Payload float64 `lengthFrom:"Size"`
+	}
+	_, err = buildSpecs(&notString{})
+	c.Assert(err, ErrorMatches, ".*Payload has a lengthFrom tag, but only string and byte slice fields may have a variable length")
+
+	type placed struct {
+		Size    uint16 `length:"2" encoding:"be" offset:"4"`
+		Payload string `lengthFrom:"Size"`
+	}
+	_, err = buildSpecs(&placed{})
+	c.Assert(err, ErrorMatches, "Struct .*placed has fields of variable length, so can't use offset tags")
+}
+
+// Test that repeatFrom must name an earlier integer field, may only
+// be used on slices, and that maxRepeat depends on it.
+func (s *SpecSuite) TestBuildSpecsRepeatFrom(c *C) {
+	type record struct {
+		Count int   `length:"2" encoding:"ascii"`
+		Items []int `length:"3" encoding:"ascii" repeatFrom:"Count" maxRepeat:"10"`
+	}
+	specs, err := buildSpecs(&record{})
+	c.Assert(err, IsNil)
+	c.Assert(specs[1].RepeatFrom, Equals, "Count")
+	c.Assert(specs[1].RepeatIndex, Equals, 0)
+	c.Assert(specs[1].MaxRepeat, Equals, 10)
+	c.Assert(isVariable(specs), Equals, true)
+	c.Assert(recordSize(specs), Equals, 2)
+
+	type missing struct {
+		Items []int `length:"3" encoding:"ascii" repeatFrom:"Count"`
+	}
+	_, err = buildSpecs(&missing{})
+	c.Assert(err, ErrorMatches, ".*Items refers to \"Count\", which must be an earlier integer field")
+
+	type notSlice struct {
+		Count int `length:"2" encoding:"ascii"`
+		Item  int `length:"3" encoding:"ascii" repeatFrom:"Count"`
+	}
+	_, err = buildSpecs(&notSlice{})
+	c.Assert(err, ErrorMatches, ".*Item has a repeatFrom tag, but only slices may repeat")
+
+	type capOnly struct {
+		Items []int `length:"3" encoding:"ascii" repeat:"2" maxRepeat:"10"`
+	}
+	_, err = buildSpecs(&capOnly{})
+	c.Assert(err, ErrorMatches, ".*Items has a maxRepeat tag, but no repeatFrom tag")
+
+	type uncapped struct {
+		Count int   `length:"2" encoding:"ascii"`
+		Items []int `length:"3" encoding:"ascii" repeatFrom:"Count"`
+	}
+	specs, err = buildSpecs(&uncapped{})
+	c.Assert(err, IsNil)
+	c.Assert(specs[1].MaxRepeat, Equals, defaultMaxRepeat)
+
+	type zeroCap struct {
+		Count int   `length:"2" encoding:"ascii"`
+		Items []int `length:"3" encoding:"ascii" repeatFrom:"Count" maxRepeat:"0"`
+	}
+	_, err = buildSpecs(&zeroCap{})
+	c.Assert(err, ErrorMatches, "Invalid maxRepeat tag '0', must be at least 1")
+}
+
+// Test that a slice of structs gets children built from the element
+// type, and that the children of the bound specs are left unbound.
+func (s *SpecSuite) TestBuildSpecsSliceOfStructs(c *C) {
+	type record struct {
+		People []Person `repeat:"3"`
+	}
+	specs, err := buildSpecs(&record{})
+	c.Assert(err, IsNil)
+	c.Assert(specs[0].Length, Equals, 0)
+	c.Assert(specs[0].Repeat, Equals, 3)
+	c.Assert(specs[0].Children, HasLen, 2)
+	c.Assert(specs[0].Children[0].StructName, Equals, "fixedfield.Person")
+	c.Assert(specs[0].Children[0].Value.IsValid(), Equals, false)
+	c.Assert(recordSize(specs), Equals, 18)
+}
+
+// Test that the repeat count of an array comes from its length, and
+// that a conflicting repeat tag is rejected.
+func (s *SpecSuite) TestBuildSpecsArrays(c *C) {
+	type record struct {
+		Ratings [10]int `length:"1" encoding:"ascii"`
+		Agreed  [2]int  `length:"1" encoding:"ascii" repeat:"2"`
+		People  [2]Person
+	}
+	specs, err := buildSpecs(&record{})
+	c.Assert(err, IsNil)
+	c.Assert(specs[0].Repeat, Equals, 10)
+	c.Assert(specs[1].Repeat, Equals, 2)
+	c.Assert(specs[2].Repeat, Equals, 2)
+	c.Assert(specs[2].Children, HasLen, 2)
+	c.Assert(recordSize(specs), Equals, 24)
+
+	type conflict struct {
+		Ratings [10]int `length:"1" encoding:"ascii" repeat:"5"`
+	}
+	_, err = buildSpecs(&conflict{})
+	c.Assert(err, ErrorMatches, "Field .*Ratings has a repeat of 5, but is an array of length 10")
+
+	type variable struct {
+		Count   int    `length:"1" encoding:"ascii"`
+		Ratings [2]int `length:"1" encoding:"ascii" repeatFrom:"Count"`
+	}
+	_, err = buildSpecs(&variable{})
+	c.Assert(err, ErrorMatches, ".*Ratings has a repeatFrom tag, but only slices may repeat")
+}
+
+// Test that buildSpecs refuses anything but a pointer to a struct.
+func (s *SpecSuite) TestBuildSpecsRequiresStructPointer(c *C) {
+	_, err := buildSpecs(Person{})
+	c.Assert(err, ErrorMatches, "Expected a non-nil pointer to a struct, got fixedfield.Person")
+	_, err = buildSpecs((*Person)(nil))
+	c.Assert(err, ErrorMatches, "Expected a non-nil pointer to a struct, got \\*fixedfield.Person")
+}
+
+// Test that specs are cached per type, but bound to each value.
+func (s *SpecSuite) TestBuildSpecsCachesLayout(c *C) {
+	first := &Transaction{Buyer: Person{Name: "Geoff"}}
+	second := &Transaction{Buyer: Person{Name: "Elisa"}}
+	firstSpecs, err := buildSpecs(first)
+	c.Assert(err, IsNil)
+	secondSpecs, err := buildSpecs(second)
+	c.Assert(err, IsNil)
+	cached, ok := specCache.Load(specKey{reflect.TypeOf(first), layoutOptions{}})
+	c.Assert(ok, Equals, true)
+	c.Assert(cached.([]spec), HasLen, 2)
+	c.Assert(firstSpecs[0].Children[0].Value.String(), Equals, "Geoff")
+	c.Assert(secondSpecs[0].Children[0].Value.String(), Equals, "Elisa")
+}
+
+func (s *SpecSuite) BenchmarkBuildSpecsUncached(c *C) {
+	structType := reflect.TypeOf(&Target{})
+	for i := 0; i < c.N; i++ {
+		buildSpecsFromStructType(structType.Elem(), structType.String(), layoutOptions{})
+	}
+}
+
+func (s *SpecSuite) BenchmarkBuildSpecsCached(c *C) {
+	target := &Target{}
+	for i := 0; i < c.N; i++ {
+		buildSpecs(target)
+	}
+}
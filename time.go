@@ -0,0 +1,243 @@
+package fixedfield
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// The Julian date formats that may be given in a julian tag, and the
+// equivalent Go layouts where there is one.  CYYDDD, where C is the
+// number of centuries since 1900, has no Go equivalent.
+var julianLayouts = map[string]string{
+	"yyddd":   "06002",
+	"yyyyddd": "2006002",
+	"cyyddd":  "",
+}
+
+// Parse a CYYDDD Julian date, e.g. "126289" for the 289th day of 2026.
+func parseCYYDDD(text string, location *time.Location) (t time.Time, err error) {
+	var century, year, day int
+
+	if len(text) != 6 {
+		return t, fmt.Errorf("CYYDDD dates must be 6 characters long, got %q", text)
+	}
+	century, err = strconv.Atoi(text[0:1])
+	if err == nil {
+		year, err = strconv.Atoi(text[1:3])
+	}
+	if err == nil {
+		day, err = strconv.Atoi(text[3:6])
+	}
+	if err != nil {
+		return t, fmt.Errorf("Invalid CYYDDD date %q", text)
+	}
+	year += 1900 + century*100
+	t = time.Date(year, 1, day, 0, 0, 0, 0, location)
+	if day < 1 || t.Year() != year {
+		return time.Time{}, fmt.Errorf("Invalid CYYDDD date %q, day-of-year out of range", text)
+	}
+	return t, nil
+}
+
+// Format a time as a CYYDDD Julian date.
+func formatCYYDDD(t time.Time) (string, error) {
+	var century int = (t.Year() - 1900) / 100
+	if t.Year() < 1900 || century > 9 {
+		return "", fmt.Errorf("Year %d cannot be written as a CYYDDD date", t.Year())
+	}
+	return fmt.Sprintf("%d%02d%03d", century, t.Year()%100, t.YearDay()), nil
+}
+
+// Is the block made up entirely of zeros or spaces?
+func isBlankDate(text string) bool {
+	return strings.Trim(text, "0") == "" || strings.Trim(text, " ") == ""
+}
+
+// Read a time from a block of text, using the layout from the spec.
+// If the spec has a zero tag then a block of all zeros or all spaces is
+// read as the zero time.
+func readTime(s spec, block []byte) (err error) {
+	var text string = s.Charset.decodeString(block)
+	var t time.Time
+
+	if s.Epoch != "" {
+		return readBinaryTime(s, block)
+	}
+	if s.Zero != "" && isBlankDate(text) {
+		s.Value.Set(reflect.ValueOf(time.Time{}))
+		return nil
+	}
+	if s.Julian == "cyyddd" {
+		t, err = parseCYYDDD(text, s.Location)
+	} else {
+		t, err = time.ParseInLocation(s.Layout, text, s.Location)
+	}
+	if err != nil {
+		return fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+	}
+	s.Value.Set(reflect.ValueOf(t))
+	return nil
+}
+
+// Given a spec, return a block of text encoding the time value of the
+// field it describes.  The zero time is written as zeros or spaces if
+// the spec has a zero tag.
+func marshalTime(s spec) (block []byte, err error) {
+	var t time.Time = s.Value.Interface().(time.Time)
+	var text string
+
+	if s.Epoch != "" {
+		return marshalBinaryTime(s)
+	}
+	switch {
+	case t.IsZero() && s.Zero == "zeros":
+		text = strings.Repeat("0", s.Length)
+	case t.IsZero() && s.Zero == "blanks":
+		text = strings.Repeat(" ", s.Length)
+	case s.Julian == "cyyddd":
+		text, err = formatCYYDDD(t.In(s.Location))
+	default:
+		text = t.In(s.Location).Format(s.Layout)
+	}
+	if err == nil && len(text) != s.Length {
+		err = fmt.Errorf("Formatted time %q does not fit a %d length field", text, s.Length)
+	}
+	if err == nil {
+		block, err = s.Charset.encodeString(text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+	}
+	return block, nil
+}
+
+// Seconds between the Windows FILETIME epoch, 1601-01-01, and the Unix
+// epoch.
+const filetimeEpochOffset = 11644473600
+
+// Return the byte order of a binary time field.
+func timeByteOrder(s spec) (binary.ByteOrder, error) {
+	switch strings.ToLower(s.Encoding) {
+	case "bigendian", "be":
+		return binary.BigEndian, nil
+	case "littleendian", "le":
+		return binary.LittleEndian, nil
+	}
+	return nil, fmt.Errorf("Times with an epoch must have an encoding of BigEndian or LittleEndian")
+}
+
+// Convert a packed DOS date and time into a time.  The date is held in
+// the high word and the time in the low word; a 2 byte field holds only
+// the date.
+func dosToTime(value uint64, blockLength int, location *time.Location) (t time.Time, err error) {
+	var date, clock uint64 = value >> 16, value & 0xffff
+
+	if blockLength == 2 {
+		date, clock = value, 0
+	}
+	if (date>>5)&0x0f < 1 || (date>>5)&0x0f > 12 || date&0x1f < 1 {
+		return t, fmt.Errorf("Invalid DOS date %04X", date)
+	}
+	return time.Date(1980+int(date>>9), time.Month((date>>5)&0x0f), int(date&0x1f),
+		int(clock>>11), int((clock>>5)&0x3f), int(clock&0x1f)*2, 0, location), nil
+}
+
+// Convert a time into a packed DOS date and time.
+func timeToDOS(t time.Time, blockLength int) (value uint64, err error) {
+	var date, clock uint64
+
+	if t.Year() < 1980 || t.Year() > 2107 {
+		return 0, fmt.Errorf("Year %d cannot be written as a DOS date", t.Year())
+	}
+	date = uint64(t.Year()-1980)<<9 | uint64(t.Month())<<5 | uint64(t.Day())
+	clock = uint64(t.Hour())<<11 | uint64(t.Minute())<<5 | uint64(t.Second()/2)
+	if blockLength == 2 {
+		return date, nil
+	}
+	return date<<16 | clock, nil
+}
+
+// Read a time from a block of bytes holding a count of units since
+// the spec's epoch.  If the spec has a zero tag then a count of zero is
+// read as the zero time.
+func readBinaryTime(s spec, block []byte) (err error) {
+	var value uint64
+	var byteOrder binary.ByteOrder
+	var t time.Time
+
+	byteOrder, err = timeByteOrder(s)
+	if err == nil {
+		value, err = readBinaryUnsignedInteger(block, s.Length, byteOrder)
+	}
+	if err != nil {
+		return fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+	}
+	if s.Zero != "" && value == 0 {
+		s.Value.Set(reflect.ValueOf(time.Time{}))
+		return nil
+	}
+	switch s.Epoch {
+	case "unix":
+		t = time.Unix(int64(value), 0)
+	case "unixms":
+		t = time.UnixMilli(int64(value))
+	case "unixns":
+		t = time.Unix(0, int64(value))
+	case "filetime":
+		t = time.Unix(int64(value/1e7)-filetimeEpochOffset, int64(value%1e7)*100)
+	case "dos":
+		t, err = dosToTime(value, s.Length, s.Location)
+		if err != nil {
+			return fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+		}
+	}
+	s.Value.Set(reflect.ValueOf(t.In(s.Location)))
+	return nil
+}
+
+// Given a spec, return a block of bytes encoding the time value of the
+// field it describes as a count of units since the spec's epoch.
+func marshalBinaryTime(s spec) (block []byte, err error) {
+	var t time.Time = s.Value.Interface().(time.Time)
+	var count int64
+	var value uint64
+	var byteOrder binary.ByteOrder
+
+	byteOrder, err = timeByteOrder(s)
+	if err == nil && !(t.IsZero() && s.Zero != "") {
+		switch s.Epoch {
+		case "unix":
+			count = t.Unix()
+		case "unixms":
+			count = t.UnixMilli()
+		case "unixns":
+			count = t.UnixNano()
+		case "filetime":
+			if t.Unix() < -filetimeEpochOffset {
+				err = fmt.Errorf("Time %s is before the FILETIME epoch", t)
+			}
+			count = (t.Unix()+filetimeEpochOffset)*1e7 + int64(t.Nanosecond()/100)
+		case "dos":
+			value, err = timeToDOS(t.In(s.Location), s.Length)
+		}
+		if count < 0 && s.Length < 8 {
+			err = fmt.Errorf("Time %s is before the %s epoch", t, s.Epoch)
+		}
+		if s.Epoch != "dos" {
+			value = uint64(count)
+		}
+	}
+	if err == nil {
+		block, err = marshalBinaryUnsignedInteger(value, s.Length, byteOrder)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+	}
+	return block, nil
+}
@@ -0,0 +1,212 @@
+package fixedfield
+
+import (
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+type TimeSuite struct{}
+
+var _ = Suite(&TimeSuite{})
+
+// The length of a time field is taken from its layout when no length
+// tag is given.
+func (s *TimeSuite) TestLayoutLength(c *C) {
+	type record struct {
+		Date    time.Time `layout:"20060102"`
+		Stamp   time.Time `layout:"2006-01-02T15:04:05"`
+		Century time.Time `julian:"cyyddd"`
+		Padded  time.Time `layout:"2006-01-02" length:"12"`
+	}
+	specs, err := buildSpecs(&record{})
+	c.Assert(err, IsNil)
+	c.Assert(specs[0].Length, Equals, 8)
+	c.Assert(specs[1].Length, Equals, 19)
+	c.Assert(specs[2].Length, Equals, 6)
+	c.Assert(specs[3].Length, Equals, 12)
+	_, err = Marshal(&record{Century: time.Now()})
+	c.Assert(err, ErrorMatches, `.*record.Padded: Formatted time "0001-01-01" does not fit a 12 length field`)
+}
+
+// Times are read and written using a Go reference layout, or one of
+// the Julian formats.
+func (s *TimeSuite) TestMarshalUnmarshalLayout(c *C) {
+	type record struct {
+		Date    time.Time `layout:"20060102"`
+		Short   time.Time `layout:"020106"`
+		Stamp   time.Time `layout:"2006-01-02T15:04:05"`
+		Julian  time.Time `julian:"yyddd"`
+		Julian7 time.Time `julian:"yyyyddd"`
+		Century time.Time `julian:"cyyddd"`
+	}
+	data := []byte("20261016" + "161026" + "2026-10-16T13:45:00" + "26289" + "2026289" + "126289")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	c.Assert(result.Date, Equals, day)
+	c.Assert(result.Short, Equals, day)
+	c.Assert(result.Stamp, Equals, day.Add(13*time.Hour+45*time.Minute))
+	c.Assert(result.Julian, Equals, day)
+	c.Assert(result.Julian7, Equals, day)
+	c.Assert(result.Century, Equals, day)
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, string(data))
+}
+
+// The tz tag gives the location in which times are read and written.
+func (s *TimeSuite) TestTimeZone(c *C) {
+	type record struct {
+		Stamp time.Time `layout:"200601021504" tz:"America/New_York"`
+	}
+	result := &record{}
+	err := Unmarshal([]byte("202610161345"), result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Stamp.UTC(), Equals, time.Date(2026, 10, 16, 17, 45, 0, 0, time.UTC))
+
+	result.Stamp = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, "202601010700")
+
+	type invalid struct {
+		Stamp time.Time `layout:"2006" tz:"Mars/Olympus_Mons"`
+	}
+	_, err = buildSpecs(&invalid{})
+	c.Assert(err, ErrorMatches, ".*unknown time zone Mars/Olympus_Mons")
+}
+
+// With a zero tag, all zero or all blank dates are the zero time, and
+// the zero time is written back as zeros or blanks.
+func (s *TimeSuite) TestZeroDates(c *C) {
+	type record struct {
+		Zeros  time.Time `layout:"20060102" zero:"zeros"`
+		Blanks time.Time `layout:"20060102" zero:"blanks"`
+	}
+	result := &record{Zeros: time.Now(), Blanks: time.Now()}
+	err := Unmarshal([]byte("00000000        "), result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Zeros.IsZero(), Equals, true)
+	c.Assert(result.Blanks.IsZero(), Equals, true)
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, "00000000        ")
+
+	type strict struct {
+		Date time.Time `layout:"20060102"`
+	}
+	err = Unmarshal([]byte("00000000"), &strict{})
+	c.Assert(err, ErrorMatches, ".*month out of range")
+}
+
+// Invalid Julian dates and tags are reported.
+func (s *TimeSuite) TestJulianErrors(c *C) {
+	_, err := parseCYYDDD("126367", time.UTC)
+	c.Assert(err, ErrorMatches, `Invalid CYYDDD date "126367", day-of-year out of range`)
+	_, err = parseCYYDDD("1262x9", time.UTC)
+	c.Assert(err, ErrorMatches, `Invalid CYYDDD date "1262x9"`)
+	_, err = formatCYYDDD(time.Date(1899, 1, 1, 0, 0, 0, 0, time.UTC))
+	c.Assert(err, ErrorMatches, "Year 1899 cannot be written as a CYYDDD date")
+
+	type record struct {
+		Date time.Time `julian:"ddd"`
+	}
+	_, err = buildSpecs(&record{})
+	c.Assert(err, ErrorMatches, "Invalid julian tag 'ddd'.*")
+}
+
+// A time field must say how it is laid out.
+func (s *TimeSuite) TestMissingLayout(c *C) {
+	type record struct {
+		Date time.Time
+	}
+	_, err := buildSpecs(&record{})
+	c.Assert(err, ErrorMatches, ".*record.Date is a time, but has no layout, julian or epoch tag")
+}
+
+// Binary times are counts of units since an epoch.
+func (s *TimeSuite) TestMarshalUnmarshalEpoch(c *C) {
+	type record struct {
+		Unix     time.Time `epoch:"unix" length:"4" encoding:"be"`
+		Millis   time.Time `epoch:"unixms" encoding:"le"`
+		Nanos    time.Time `epoch:"unixns" encoding:"be"`
+		Filetime time.Time `epoch:"filetime" encoding:"le"`
+		DOS      time.Time `epoch:"dos" encoding:"le"`
+		DOSDate  time.Time `epoch:"dos" length:"2" encoding:"le"`
+	}
+	data := []byte("\x6a\xd2\x2a\x7a" +
+		"\x8a\xed\xf5\x44\xa1\x01\x00\x00" +
+		"\x18\xdf\x06\x81\x80\xe8\x44\x7b" +
+		"\x00\x39\xa7\x9b\x74\x5d\xdd\x01" +
+		"\xaf\x6d\x50\x5d" +
+		"\x50\x5d")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	stamp := time.Date(2026, 10, 16, 13, 45, 30, 0, time.UTC)
+	c.Assert(result.Unix, Equals, stamp)
+	c.Assert(result.Millis, Equals, stamp.Add(250*time.Millisecond))
+	c.Assert(result.Nanos, Equals, stamp.Add(123))
+	c.Assert(result.Filetime, Equals, stamp)
+	c.Assert(result.DOS, Equals, stamp)
+	c.Assert(result.DOSDate, Equals, time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC))
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, data)
+}
+
+// Times that can't be represented in a binary field are errors.
+func (s *TimeSuite) TestEpochErrors(c *C) {
+	type unix struct {
+		Value time.Time `epoch:"unix" length:"4" encoding:"le"`
+	}
+	_, err := Marshal(&unix{Value: time.Date(1969, 1, 1, 0, 0, 0, 0, time.UTC)})
+	c.Assert(err, ErrorMatches, ".*is before the unix epoch")
+
+	type dos struct {
+		Value time.Time `epoch:"dos" encoding:"be"`
+	}
+	_, err = Marshal(&dos{Value: time.Date(1979, 1, 1, 0, 0, 0, 0, time.UTC)})
+	c.Assert(err, ErrorMatches, ".*Year 1979 cannot be written as a DOS date")
+	err = Unmarshal([]byte("\x00\x00\x00\x00"), &dos{})
+	c.Assert(err, ErrorMatches, ".*Invalid DOS date 0000")
+
+	type ascii struct {
+		Value time.Time `epoch:"unix" encoding:"ascii"`
+	}
+	err = Unmarshal([]byte("\x00\x00\x00\x00\x00\x00\x00\x00"), &ascii{})
+	c.Assert(err, ErrorMatches, ".*Times with an epoch must have an encoding of BigEndian or LittleEndian")
+
+	type invalid struct {
+		Value time.Time `epoch:"mayan"`
+	}
+	_, err = buildSpecs(&invalid{})
+	c.Assert(err, ErrorMatches, "Invalid epoch tag 'mayan'.*")
+
+	type oddLength struct {
+		Value time.Time `epoch:"unix" length:"3" encoding:"be"`
+	}
+	_, err = buildSpecs(&oddLength{})
+	c.Assert(err, ErrorMatches, "Invalid length 3 for a unix time, must be 1, 2, 4 or 8")
+
+	type longDOS struct {
+		Value time.Time `epoch:"dos" length:"8" encoding:"be"`
+	}
+	_, err = buildSpecs(&longDOS{})
+	c.Assert(err, ErrorMatches, "Invalid length 8 for a dos time, must be 2 or 4")
+}
+
+// With a zero tag, a count of zero is the zero time.
+func (s *TimeSuite) TestEpochZero(c *C) {
+	type record struct {
+		Value time.Time `epoch:"dos" zero:"zeros" encoding:"be"`
+	}
+	result := &record{Value: time.Now()}
+	err := Unmarshal([]byte("\x00\x00\x00\x00"), result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Value.IsZero(), Equals, true)
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, []byte("\x00\x00\x00\x00"))
+}
@@ -2,51 +2,578 @@ package fixedfield
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func marshalASCIIInteger(s spec) (block []byte, err error) {
-	var formatString, candidate string
+// Right justify the text of a number in an ASCII field, returning an
+// error if it is too long to fit.  Numbers are padded with spaces
+// unless the field has a padding tag.  When padding with zeros any
+// sign comes before them, e.g. "-000012345".
+func formatASCIINumber(s spec, candidate string) (block []byte, err error) {
+	var padding, sign string
 
-	formatString = "%" + strconv.Itoa(s.Length) + "d"
-	candidate = fmt.Sprintf(formatString, int(s.Value.Int()))
 	if len(candidate) > s.Length {
 		return nil, fmt.Errorf("Field %s.%s overflowed configured field length (Tried to write %s to a %d length ASCII field)",
 			s.StructName, s.StructField.Name, candidate, s.Length)
 	}
-	return []byte(candidate), nil
+	padding = s.Padding[:1]
+	if padding == "0" && strings.HasPrefix(candidate, "-") {
+		sign, candidate = "-", candidate[1:]
+	}
+	return []byte(sign + strings.Repeat(padding, s.Length-len(sign)-len(candidate)) + candidate), nil
+}
+
+func marshalASCIIInteger(s spec, value int64) (block []byte, err error) {
+	return formatASCIINumber(s, strconv.FormatInt(value, 10))
+}
+
+// Convert a signed 64 bit integer into an array of bytes of a known
+// length and byte order.  An error is returned if the value cannot be
+// represented in the given number of bytes.
+func marshalBinaryInteger(value int64, blockLength int, byteOrder binary.ByteOrder) (block []byte, err error) {
+	buffer := bytes.NewBuffer(nil)
+	switch blockLength {
+	case 1:
+		if value < math.MinInt8 || value > math.MaxInt8 {
+			return nil, fmt.Errorf("Value %d overflows a 1 byte signed integer", value)
+		}
+		err = binary.Write(buffer, byteOrder, int8(value))
+	case 2:
+		if value < math.MinInt16 || value > math.MaxInt16 {
+			return nil, fmt.Errorf("Value %d overflows a 2 byte signed integer", value)
+		}
+		err = binary.Write(buffer, byteOrder, int16(value))
+	case 4:
+		if value < math.MinInt32 || value > math.MaxInt32 {
+			return nil, fmt.Errorf("Value %d overflows a 4 byte signed integer", value)
+		}
+		err = binary.Write(buffer, byteOrder, int32(value))
+	case 8:
+		err = binary.Write(buffer, byteOrder, value)
+	default:
+		return nil, fmt.Errorf("Binary integers must have a length of 1, 2, 4 or 8 bytes, %d bytes specified", blockLength)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func makeMarshalIntegerError(s spec) error {
+	reflectType := s.StructField.Type
+	kind := reflectType.Kind()
+	typeName := kind.String()
+	name := s.StructName + "." + s.StructField.Name
+	return fmt.Errorf("Failure marshalling %s field '%s'. Integer fields must be annotated with an encoding type of BigEndian, LittleEndian, ASCII, Packed or Zoned", typeName, name)
 }
 
+// Given a spec, return a block of bytes encoding the signed integer
+// value of the field it describes.
 func marshalInteger(s spec) (block []byte, err error) {
+	var value int64 = s.Value.Int()
+
+	if s.Unit != 0 {
+		value, err = durationToCount(time.Duration(value), s.Unit, s.Rounding)
+		if err != nil {
+			return nil, fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+		}
+	}
+	switch strings.ToLower(s.Encoding) {
+	case "ascii":
+		block, err = marshalASCIIInteger(s, value)
+		return s.Charset.encode(block), err
+	case "bigendian", "be":
+		block, err = marshalBinaryInteger(value, s.Length, binary.BigEndian)
+	case "littleendian", "le":
+		block, err = marshalBinaryInteger(value, s.Length, binary.LittleEndian)
+	case "packed", "zoned":
+		block, err = marshalDecimalInteger(s, value, true)
+	default:
+		return nil, makeMarshalIntegerError(s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+	}
+	return block, nil
+}
+
+func marshalASCIIUnsignedInteger(s spec) (block []byte, err error) {
+	return formatASCIINumber(s, strconv.FormatUint(s.Value.Uint(), 10))
+}
+
+// Convert an unsigned 64 bit integer into an array of bytes of a
+// known length and byte order.  An error is returned if the value
+// cannot be represented in the given number of bytes.
+func marshalBinaryUnsignedInteger(value uint64, blockLength int, byteOrder binary.ByteOrder) (block []byte, err error) {
+	buffer := bytes.NewBuffer(nil)
+	switch blockLength {
+	case 1:
+		if value > math.MaxUint8 {
+			return nil, fmt.Errorf("Value %d overflows a 1 byte unsigned integer", value)
+		}
+		err = binary.Write(buffer, byteOrder, uint8(value))
+	case 2:
+		if value > math.MaxUint16 {
+			return nil, fmt.Errorf("Value %d overflows a 2 byte unsigned integer", value)
+		}
+		err = binary.Write(buffer, byteOrder, uint16(value))
+	case 4:
+		if value > math.MaxUint32 {
+			return nil, fmt.Errorf("Value %d overflows a 4 byte unsigned integer", value)
+		}
+		err = binary.Write(buffer, byteOrder, uint32(value))
+	case 8:
+		err = binary.Write(buffer, byteOrder, value)
+	default:
+		return nil, fmt.Errorf("Binary integers must have a length of 1, 2, 4 or 8 bytes, %d bytes specified", blockLength)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Given a spec, return a block of bytes encoding the unsigned integer
+// value of the field it describes.
+func marshalUnsignedInteger(s spec) (block []byte, err error) {
 	switch strings.ToLower(s.Encoding) {
 	case "ascii":
-		return marshalASCIIInteger(s)
+		block, err = marshalASCIIUnsignedInteger(s)
+		return s.Charset.encode(block), err
+	case "bigendian", "be":
+		block, err = marshalBinaryUnsignedInteger(s.Value.Uint(), s.Length, binary.BigEndian)
+	case "littleendian", "le":
+		block, err = marshalBinaryUnsignedInteger(s.Value.Uint(), s.Length, binary.LittleEndian)
+	case "packed", "zoned":
+		if s.Value.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("Field %s.%s: Value %d overflows a %s decimal", s.StructName, s.StructField.Name, s.Value.Uint(), s.Encoding)
+		}
+		block, err = marshalDecimalInteger(s, int64(s.Value.Uint()), false)
+	default:
+		return nil, makeMarshalIntegerError(s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+	}
+	return block, nil
+}
+
+// Render a float as ASCII text that fits exactly in the length of
+// the field.  If the spec has a precision then exactly that many
+// decimal places are written, otherwise as many decimal places as will
+// fit are used.
+func marshalASCIIFloat(s spec, bitSize int) (block []byte, err error) {
+	var candidate string
+	var value float64
+
+	value = s.Value.Float()
+	if s.Precision >= 0 {
+		candidate = strconv.FormatFloat(value, 'f', s.Precision, bitSize)
+	} else {
+		candidate = strconv.FormatFloat(value, 'f', -1, bitSize)
+		for decimals := s.Length; len(candidate) > s.Length && decimals >= 0; decimals-- {
+			candidate = strconv.FormatFloat(value, 'f', decimals, bitSize)
+		}
+	}
+	return formatASCIINumber(s, candidate)
+}
+
+// Convert a 64 bit float into an IEEE-754 array of bytes of a known
+// length and byte order.
+func marshalBinaryFloat(value float64, blockLength int, byteOrder binary.ByteOrder) (block []byte, err error) {
+	buffer := bytes.NewBuffer(nil)
+	switch blockLength {
+	case 4:
+		if !math.IsInf(value, 0) && math.Abs(value) > math.MaxFloat32 {
+			return nil, fmt.Errorf("Value %g overflows a 4 byte float", value)
+		}
+		err = binary.Write(buffer, byteOrder, float32(value))
+	case 8:
+		err = binary.Write(buffer, byteOrder, value)
+	default:
+		return nil, fmt.Errorf("Binary floats must have a length of either 4 or 8 bytes (float32 or float64 respectively).")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Given a spec, return a block of bytes encoding the floating point
+// value of the field it describes.
+func marshalFloat(s spec, kind reflect.Kind) (block []byte, err error) {
+	var bitSize int = 64
+	var d Decimal
+	var rounding string = s.Rounding
+
+	if kind == reflect.Float32 {
+		bitSize = 32
+	}
+	if s.Scale != 0 || isDecimalEncoding(s.Encoding) {
+		if rounding == "" {
+			rounding = "halfup"
+		}
+		d, err = floatToDecimal(s.Value.Float(), bitSize)
+		if err == nil {
+			block, err = marshalScaledDecimal(s, d, rounding)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+		}
+		return block, nil
+	}
+
+	switch strings.ToLower(s.Encoding) {
+	case "ascii":
+		block, err = marshalASCIIFloat(s, bitSize)
+		return s.Charset.encode(block), err
+	case "bigendian", "be":
+		block, err = marshalBinaryFloat(s.Value.Float(), s.Length, binary.BigEndian)
+	case "littleendian", "le":
+		block, err = marshalBinaryFloat(s.Value.Float(), s.Length, binary.LittleEndian)
+	default:
+		return nil, fmt.Errorf("Invalid encoding for a floating point value specified. %s",
+			s.String())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+	}
+	return block, nil
+}
+
+// Given a spec, return a block of bytes encoding the boolean value of
+// the field it describes.  Binary booleans are a single byte, whilst
+// ASCII booleans use the first of the TrueBytes or FalseBytes.
+func marshalBool(s spec) (block []byte, err error) {
+	var boolVal bool = s.Value.Bool()
+
+	switch strings.ToLower(s.Encoding) {
+	case "littleendian", "le", "bigendian", "be", "byte":
+		if s.Length > 1 {
+			return nil, fmt.Errorf("Booleans can only be 1 byte long, %d bytes specified for %s", s.Length, s.StructField.Name)
+		}
+		if boolVal {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case "ascii":
+		if s.Length > 1 {
+			return nil, fmt.Errorf("Booleans can only be 1 byte long, %d bytes specified for %s", s.Length, s.StructField.Name)
+		}
+		if boolVal {
+			return s.Charset.encode(s.TrueBytes[:1]), nil
+		}
+		return s.Charset.encode(s.FalseBytes[:1]), nil
 	}
-	return
+	return nil, fmt.Errorf("Invalid encoding for a boolean value specified. %s",
+		s.String())
+}
+
+// Given a spec, return a block of bytes containing the string value of
+// the field it describes, padded and aligned to the field length.
+// Over-long values are an error unless the spec permits truncation.
+func marshalString(s spec) (block []byte, err error) {
+	var value, padding []byte
+	var gap, leftGap int
+
+	value, err = s.Charset.encodeString(s.Value.String())
+	if err != nil {
+		return nil, fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+	}
+	padding = s.Charset.encode([]byte(s.Padding[:1]))
+	if len(value) > s.Length {
+		if !s.Truncate {
+			return nil, fmt.Errorf("Field %s.%s overflowed configured field length (Tried to write %q to a %d length field)",
+				s.StructName, s.StructField.Name, s.Value.String(), s.Length)
+		}
+		value = value[:s.Length]
+	}
+	gap = s.Length - len(value)
+	switch s.Align {
+	case "right":
+		leftGap = gap
+	case "center":
+		leftGap = gap / 2
+	}
+	block = make([]byte, 0, s.Length)
+	block = append(block, bytes.Repeat(padding, leftGap)...)
+	block = append(block, value...)
+	block = append(block, bytes.Repeat(padding, gap-leftGap)...)
+	return block, nil
+}
+
+// Write the unscaled value of a packed or zoned decimal field.
+func marshalDecimalInteger(s spec, value int64, signed bool) (block []byte, err error) {
+	if strings.ToLower(s.Encoding) == "zoned" {
+		return marshalZonedDecimal(value, s.Length, signed, s.Sign == "leading", s.Charset.isEBCDIC())
+	}
+	return marshalPackedDecimal(value, s.Length, signed)
+}
+
+// Write a number with an implied decimal point, s.Scale digits from
+// the right, discarding any further digits according to the rounding
+// mode.
+func marshalScaledDecimal(s spec, d Decimal, rounding string) (block []byte, err error) {
+	var unscaled int64
+
+	unscaled, err = d.round(s.Scale, rounding)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(s.Encoding) {
+	case "ascii":
+		block, err = formatASCIINumber(s, strconv.FormatInt(unscaled, 10))
+		return s.Charset.encode(block), err
+	case "bigendian", "be":
+		return marshalBinaryInteger(unscaled, s.Length, binary.BigEndian)
+	case "littleendian", "le":
+		return marshalBinaryInteger(unscaled, s.Length, binary.LittleEndian)
+	case "packed", "zoned":
+		return marshalDecimalInteger(s, unscaled, true)
+	}
+	return nil, fmt.Errorf("Invalid encoding for a decimal value specified. %s",
+		s.String())
+}
+
+// Write a Decimal to an ASCII field with an explicit decimal point.
+// If the spec has a precision then exactly that many decimal places
+// are written, otherwise the Decimal's own scale is used.
+func marshalASCIIDecimal(s spec, d Decimal) (block []byte, err error) {
+	var unscaled int64
+
+	if s.Precision >= 0 {
+		unscaled, err = d.round(s.Precision, s.Rounding)
+		if err != nil {
+			return nil, err
+		}
+		d = Decimal{Unscaled: unscaled, Scale: s.Precision}
+	}
+	block, err = formatASCIINumber(s, d.String())
+	return s.Charset.encode(block), err
+}
+
+// Given a spec, return a block of bytes encoding the Decimal value of
+// the field it describes.
+func marshalDecimal(s spec) (block []byte, err error) {
+	var d Decimal = s.Value.Interface().(Decimal)
+
+	if s.Scale == 0 && strings.ToLower(s.Encoding) == "ascii" {
+		block, err = marshalASCIIDecimal(s, d)
+	} else {
+		block, err = marshalScaledDecimal(s, d, s.Rounding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+	}
+	return block, nil
 }
 
 func marshalKind(kind reflect.Kind, s spec) (block []byte, err error) {
+	switch s.Value.Type() {
+	case decimalType:
+		return marshalDecimal(s)
+	case timeType:
+		return marshalTime(s)
+	}
 	switch kind {
 	case reflect.String:
-		block = []byte(s.Value.String())
-	case reflect.Int:
+		block, err = marshalString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		block, err = marshalInteger(s)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		block, err = marshalUnsignedInteger(s)
+	case reflect.Float64, reflect.Float32:
+		block, err = marshalFloat(s, kind)
+	case reflect.Bool:
+		block, err = marshalBool(s)
+	case reflect.Struct:
+		// Recur, exploring the nested specification.
+		block, err = populateBytesFromSpecAndStruct(s.Children)
 	}
 	return block, err
 }
 
+// Given a spec for a slice or array, marshal each of its elements in
+// turn.  Slices shorter than the repeat count are padded with zero
+// values.
+func marshalSlice(s spec) (block []byte, err error) {
+	var buffer *bytes.Buffer
+	var elemBlock []byte
+	var sliceValue reflect.Value
+	var elemType reflect.Type
+	var children []spec
+
+	sliceValue = s.Value
+	elemType = sliceValue.Type().Elem()
+	children = s.Children
+	if sliceValue.Len() > s.Repeat {
+		return nil, fmt.Errorf("Field %s.%s has %d elements, but only %d may be written",
+			s.StructName, s.StructField.Name, sliceValue.Len(), s.Repeat)
+	}
+	buffer = bytes.NewBuffer(nil)
+	for offset := 0; offset < s.Repeat; offset++ {
+		if offset < sliceValue.Len() {
+			s.Value = sliceValue.Index(offset)
+		} else {
+			s.Value = reflect.Zero(elemType)
+		}
+		if children != nil {
+			s.Children = bindSpecs(children, s.Value)
+		}
+		elemBlock, err = marshalKind(elemType.Kind(), s)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(elemBlock)
+	}
+	return buffer.Bytes(), nil
+}
+
+// Build the block of bytes for a single struct element, which may be
+// a slice or a nested struct.
+func marshalField(s spec) (block []byte, err error) {
+	if s.Filler {
+		return bytes.Repeat(s.Charset.encode([]byte(s.Fill[:1])), s.Size()), nil
+	}
+	kind := s.Value.Kind()
+	if s.Block {
+		return marshalBytes(s)
+	}
+	if kind == reflect.Slice || kind == reflect.Array {
+		return marshalSlice(s)
+	}
+	return marshalKind(kind, s)
+}
+
+// Return true if a count can't be held by the integer value.
+func overflowsCount(value reflect.Value, count int) bool {
+	switch value.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return value.OverflowUint(uint64(count))
+	}
+	return value.OverflowInt(int64(count))
+}
+
+// Return the bytes that a variable length field will occupy.
+func encodeVariable(s spec) (value []byte, err error) {
+	if s.Block {
+		return encodeBytes(s, s.Value.Bytes()), nil
+	}
+	value, err = s.Charset.encodeString(s.Value.String())
+	if err != nil {
+		return nil, fmt.Errorf("Field %s.%s: %s", s.StructName, s.StructField.Name, err)
+	}
+	return value, nil
+}
 
+// Size each variable length or variable repeat field to fit its
+// value, and substitute that size for the value of the field that
+// records it.
+func resolveCounts(specs []spec) (err error) {
+	var value []byte
+	var source *spec
+	var count, index int
+	var resolved = map[int]int{}
+	var resolvedBy = map[int]string{}
+
+	for i := range specs {
+		switch {
+		case len(specs[i].LengthFrom) != 0:
+			value, err = encodeVariable(specs[i])
+			if err != nil {
+				return err
+			}
+			count = len(value)
+			specs[i].Length = count
+			index = specs[i].LengthIndex
+			source = &specs[index]
+			if overflowsCount(source.Value, count) {
+				return fmt.Errorf("Field %s.%s is %d bytes long, which is too long for field %s",
+					specs[i].StructName, specs[i].StructField.Name, count, source.StructField.Name)
+			}
+		case len(specs[i].RepeatFrom) != 0:
+			count = specs[i].Value.Len()
+			if count > specs[i].MaxRepeat {
+				return fmt.Errorf("Field %s.%s has %d elements, but only %d may be written",
+					specs[i].StructName, specs[i].StructField.Name, count, specs[i].MaxRepeat)
+			}
+			specs[i].Repeat = count
+			index = specs[i].RepeatIndex
+			source = &specs[index]
+			if overflowsCount(source.Value, count) {
+				return fmt.Errorf("Field %s.%s has %d elements, which is too many for field %s",
+					specs[i].StructName, specs[i].StructField.Name, count, source.StructField.Name)
+			}
+		default:
+			continue
+		}
+		if previous, ok := resolved[index]; ok && previous != count {
+			return fmt.Errorf("Fields %s.%s and %s.%s share count field %s, but need counts of %d and %d",
+				specs[i].StructName, resolvedBy[index], specs[i].StructName, specs[i].StructField.Name,
+				source.StructField.Name, previous, count)
+		}
+		resolved[index] = count
+		resolvedBy[index] = specs[i].StructField.Name
+		source.Value = reflect.ValueOf(count).Convert(source.Value.Type())
+	}
+	return nil
+}
+
+// Fill the gaps between positioned fields with spaces, in the default
+// charset of the record.  A charset tag only applies to its own field.
+func fillGaps(specs []spec, data []byte) {
+	var ordered []spec = append([]spec(nil), specs...)
+	var space []byte = specs[0].BaseCharset.encode([]byte(" "))
+	var end int
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Offset < ordered[j].Offset
+	})
+	for _, s := range ordered {
+		if s.Offset > end {
+			copy(data[end:s.Offset], bytes.Repeat(space, s.Offset-end))
+		}
+		if s.Offset+fieldSize(s) > end {
+			end = s.Offset + fieldSize(s)
+		}
+	}
+}
+
+// Given a slice of specs, build a block of bytes from the values in
+// the struct they describe.  When any field has an explicit offset,
+// each field is written at its own position and any gaps between
+// fields are filled with spaces.
 func populateBytesFromSpecAndStruct(specs []spec) (data []byte, err error) {
 	var buffer *bytes.Buffer
 	var block []byte
 
+	err = resolveCounts(specs)
+	if err != nil {
+		return nil, err
+	}
+	if isPlaced(specs) {
+		data = make([]byte, recordSize(specs))
+		for _, s := range specs {
+			block, err = marshalField(s)
+			if err != nil {
+				return nil, err
+			}
+			copy(data[s.Offset:s.Offset+fieldSize(s)], block)
+		}
+		fillGaps(specs, data)
+		return data, nil
+	}
+
 	buffer = bytes.NewBuffer(nil)
 	for _, s := range specs {
-		kind := s.Value.Kind()
-		block, err = marshalKind(kind, s)
+		block, err = marshalField(s)
 		if err != nil {
 			return nil, err
 		}
@@ -58,7 +585,9 @@ func populateBytesFromSpecAndStruct(specs []spec) (data []byte, err error) {
 	return buffer.Bytes(), nil
 }
 
-
+// Marshal returns the struct pointed to by v as a single record.
+// Offset tags are always 0-based here; use an Encoder with
+// SetOffsetBase to write a 1-based layout.
 func Marshal(v interface{}) (result []byte, err error) {
 	var specs []spec
 
@@ -1,8 +1,11 @@
 package fixedfield
 
 import (
+	"encoding/binary"
 	. "launchpad.net/gocheck"
 	"math"
+	"reflect"
+	"strings"
 )
 
 type WriteSuite struct{}
@@ -85,6 +88,321 @@ func (s *WriteSuite) TestMarshallIntegerOverflow(c *C) {
 	c.Assert(err, ErrorMatches, ".*overflow.*")
 }
 
+// Test marshalBinaryInteger encodes an 8bit, Little Endian negative value.
+func (s *WriteSuite) TestMarshalBinaryInteger8BitLittleEndianNegative(c *C) {
+	block, err := marshalBinaryInteger(-16, 1, binary.LittleEndian)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\xf0"))
+}
+
+// Test marshalBinaryInteger encodes a 16bit, Little Endian value.
+func (s *WriteSuite) TestMarshalBinaryInteger16BitLittleEndian(c *C) {
+	block, err := marshalBinaryInteger(272, 2, binary.LittleEndian)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\x10\x01"))
+}
+
+// Test marshalBinaryInteger encodes a 32bit, Big Endian value.
+func (s *WriteSuite) TestMarshalBinaryInteger32BitBigEndian(c *C) {
+	block, err := marshalBinaryInteger(269484289, 4, binary.BigEndian)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\x10\x10\x01\x01"))
+}
+
+// Test marshalBinaryInteger encodes a 64bit, Big Endian negative value.
+func (s *WriteSuite) TestMarshalBinaryInteger64BitBigEndianNegative(c *C) {
+	block, err := marshalBinaryInteger(-1152622432880619519, 8, binary.BigEndian)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\xf0\x01\x10\x01\x10\x01\x10\x01"))
+}
+
+// Test marshalBinaryInteger refuses values that don't fit the length.
+func (s *WriteSuite) TestMarshalBinaryIntegerOverflow(c *C) {
+	_, err := marshalBinaryInteger(128, 1, binary.LittleEndian)
+	c.Assert(err, ErrorMatches, ".*overflows a 1 byte.*")
+	_, err = marshalBinaryInteger(-32769, 2, binary.BigEndian)
+	c.Assert(err, ErrorMatches, ".*overflows a 2 byte.*")
+	_, err = marshalBinaryInteger(math.MaxInt32+1, 4, binary.BigEndian)
+	c.Assert(err, ErrorMatches, ".*overflows a 4 byte.*")
+}
+
+// Test marshalBinaryInteger refuses unsupported lengths.
+func (s *WriteSuite) TestMarshalBinaryIntegerInvalidLength(c *C) {
+	_, err := marshalBinaryInteger(1, 3, binary.LittleEndian)
+	c.Assert(err, ErrorMatches, "Binary integers must have a length of 1, 2, 4 or 8 bytes.*")
+}
+
+// Test marshalInteger with a Big Endian binary value
+func (s *WriteSuite) TestMarshalIntegerBigEndian(c *C) {
+	type target struct {
+		Value int16 `encoding:"be" length:"2"`
+	}
+	t := &target{Value: -256}
+	specs, err := buildSpecs(t)
+	c.Assert(err, IsNil)
+	block, err := marshalInteger(specs[0])
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\xff\x00"))
+}
+
+// Test marshalInteger with a Little Endian binary value that overflows
+func (s *WriteSuite) TestMarshalIntegerLittleEndianOverflow(c *C) {
+	type target struct {
+		Value int `encoding:"le" length:"1"`
+	}
+	t := &target{Value: 300}
+	specs, err := buildSpecs(t)
+	c.Assert(err, IsNil)
+	_, err = marshalInteger(specs[0])
+	c.Assert(err, ErrorMatches, "Field .*target.Value: Value 300 overflows.*")
+}
+
+// Test marshalInteger with invalid encoding returns an error
+func (s *WriteSuite) TestMarshalIntegerInvalidEncoding(c *C) {
+	type target struct {
+		Value int `encoding:"Barney" length:"1"`
+	}
+	t := &target{Value: 1}
+	specs, err := buildSpecs(t)
+	c.Assert(err, IsNil)
+	_, err = marshalInteger(specs[0])
+	c.Assert(err, ErrorMatches, "Failure marshalling int field.*")
+}
+
+// Test marshalBinaryUnsignedInteger encodes a 16bit, Big Endian value.
+func (s *WriteSuite) TestMarshalBinaryUnsignedInteger16BitBigEndian(c *C) {
+	block, err := marshalBinaryUnsignedInteger(65280, 2, binary.BigEndian)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\xff\x00"))
+}
+
+// Test marshalBinaryUnsignedInteger encodes a 64bit, Little Endian value.
+func (s *WriteSuite) TestMarshalBinaryUnsignedInteger64BitLittleEndian(c *C) {
+	block, err := marshalBinaryUnsignedInteger(math.MaxUint64, 8, binary.LittleEndian)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\xff\xff\xff\xff\xff\xff\xff\xff"))
+}
+
+// Test marshalBinaryUnsignedInteger refuses values that don't fit the length.
+func (s *WriteSuite) TestMarshalBinaryUnsignedIntegerOverflow(c *C) {
+	_, err := marshalBinaryUnsignedInteger(256, 1, binary.LittleEndian)
+	c.Assert(err, ErrorMatches, ".*overflows a 1 byte unsigned.*")
+	_, err = marshalBinaryUnsignedInteger(65536, 2, binary.LittleEndian)
+	c.Assert(err, ErrorMatches, ".*overflows a 2 byte unsigned.*")
+	_, err = marshalBinaryUnsignedInteger(math.MaxUint32+1, 4, binary.BigEndian)
+	c.Assert(err, ErrorMatches, ".*overflows a 4 byte unsigned.*")
+}
+
+// Test marshalUnsignedInteger with an ASCII value
+func (s *WriteSuite) TestMarshalUnsignedIntegerASCII(c *C) {
+	type target struct {
+		Value uint32 `encoding:"ascii" length:"4"`
+	}
+	t := &target{Value: 42}
+	specs, err := buildSpecs(t)
+	c.Assert(err, IsNil)
+	block, err := marshalUnsignedInteger(specs[0])
+	c.Assert(err, IsNil)
+	c.Assert(string(block), Equals, "  42")
+	t.Value = 12345
+	_, err = marshalUnsignedInteger(specs[0])
+	c.Assert(err, ErrorMatches, ".*overflow.*")
+}
+
+// Test that unsigned fields round trip through Marshal and Unmarshal
+func (s *WriteSuite) TestMarshalUnsignedIntegerRoundTrip(c *C) {
+	type target struct {
+		A uint8  `encoding:"le" length:"1"`
+		B uint16 `encoding:"be" length:"2"`
+		C uint64 `encoding:"ascii" length:"5"`
+	}
+	t := &target{A: 200, B: 4097, C: 99}
+	data, err := Marshal(t)
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte("\xc8\x10\x01   99"))
+	result := &target{}
+	err = Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(*result, Equals, *t)
+}
+
+// Test marshalBinaryFloat encodes a Little Endian float64.
+func (s *WriteSuite) TestMarshalBinaryFloatLittleEndian(c *C) {
+	block, err := marshalBinaryFloat(math.Pi, 8, binary.LittleEndian)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\x18\x2d\x44\x54\xfb\x21\x09\x40"))
+}
+
+// Test marshalBinaryFloat encodes a Big Endian float32.
+func (s *WriteSuite) TestMarshalBinaryFloatBigEndian32Bit(c *C) {
+	block, err := marshalBinaryFloat(float64(float32(math.Pi)), 4, binary.BigEndian)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\x40\x49\x0f\xdb"))
+}
+
+// Test marshalBinaryFloat refuses invalid lengths and out of range values.
+func (s *WriteSuite) TestMarshalBinaryFloatErrors(c *C) {
+	_, err := marshalBinaryFloat(1.0, 2, binary.BigEndian)
+	c.Assert(err, ErrorMatches, "Binary floats must have a length of either 4 or 8 bytes.*")
+	_, err = marshalBinaryFloat(math.MaxFloat64, 4, binary.BigEndian)
+	c.Assert(err, ErrorMatches, ".*overflows a 4 byte float")
+}
+
+// Test marshalFloat fits as many decimal places as possible into an
+// ASCII field when no precision is given.
+func (s *WriteSuite) TestMarshalFloatASCII(c *C) {
+	type target struct {
+		Value float64 `encoding:"ascii" length:"6"`
+	}
+	t := &target{Value: 1.23}
+	specs, err := buildSpecs(t)
+	c.Assert(err, IsNil)
+	block, err := marshalFloat(specs[0], reflect.Float64)
+	c.Assert(err, IsNil)
+	c.Assert(string(block), Equals, "  1.23")
+	t.Value = 10000.1289
+	block, err = marshalFloat(specs[0], reflect.Float64)
+	c.Assert(err, IsNil)
+	c.Assert(string(block), Equals, " 10000")
+	t.Value = -3.14159
+	block, err = marshalFloat(specs[0], reflect.Float64)
+	c.Assert(err, IsNil)
+	c.Assert(string(block), Equals, "-3.142")
+	t.Value = 1234567
+	_, err = marshalFloat(specs[0], reflect.Float64)
+	c.Assert(err, ErrorMatches, ".*overflow.*")
+}
+
+// Test marshalFloat honours the precision tag for ASCII fields.
+func (s *WriteSuite) TestMarshalFloatASCIIPrecision(c *C) {
+	type target struct {
+		Value float32 `encoding:"ascii" length:"8" precision:"2"`
+	}
+	t := &target{Value: 3.14159}
+	specs, err := buildSpecs(t)
+	c.Assert(err, IsNil)
+	block, err := marshalFloat(specs[0], reflect.Float32)
+	c.Assert(err, IsNil)
+	c.Assert(string(block), Equals, "    3.14")
+	t.Value = 1234567.5
+	_, err = marshalFloat(specs[0], reflect.Float32)
+	c.Assert(err, ErrorMatches, ".*overflow.*")
+}
+
+// Test that binary booleans are written as a single 0 or 1 byte.
+func (s *WriteSuite) TestMarshalBoolByte(c *C) {
+	type target struct {
+		Value bool
+	}
+	t := &target{Value: true}
+	specs, err := buildSpecs(t)
+	c.Assert(err, IsNil)
+	block, err := marshalBool(specs[0])
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\x01"))
+	t.Value = false
+	block, err = marshalBool(specs[0])
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\x00"))
+}
+
+// Test that ASCII booleans are written using the first of the
+// trueChars or falseChars.
+func (s *WriteSuite) TestMarshalBoolASCII(c *C) {
+	type target struct {
+		Value bool `encoding:"ascii" trueChars:"jJ" falseChars:"nN"`
+	}
+	t := &target{Value: true}
+	specs, err := buildSpecs(t)
+	c.Assert(err, IsNil)
+	block, err := marshalBool(specs[0])
+	c.Assert(err, IsNil)
+	c.Assert(string(block), Equals, "j")
+	t.Value = false
+	block, err = marshalBool(specs[0])
+	c.Assert(err, IsNil)
+	c.Assert(string(block), Equals, "n")
+}
+
+// Test that marshalBool rejects booleans longer than a byte.
+func (s *WriteSuite) TestMarshalBoolTooLong(c *C) {
+	type target struct {
+		Value bool `length:"2"`
+	}
+	specs, err := buildSpecs(&target{})
+	c.Assert(err, IsNil)
+	_, err = marshalBool(specs[0])
+	c.Assert(err, ErrorMatches, "Booleans can only be 1 byte long.*")
+}
+
+// Test that strings are padded according to their alignment.
+func (s *WriteSuite) TestMarshalStringAlignment(c *C) {
+	type target struct {
+		Left   string `length:"5"`
+		Right  string `length:"5" align:"right" padding:"*"`
+		Center string `length:"6" align:"center" padding:"_"`
+	}
+	t := &target{Left: "Bob", Right: "Bob", Center: "Bob"}
+	data, err := Marshal(t)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "Bob  **Bob_Bob__")
+	result := &target{}
+	err = Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(*result, Equals, *t)
+}
+
+// Test that over-long strings are rejected unless truncation is
+// permitted.
+func (s *WriteSuite) TestMarshalStringOverflow(c *C) {
+	type target struct {
+		Value string `length:"3"`
+	}
+	_, err := Marshal(&target{Value: "Geoff"})
+	c.Assert(err, ErrorMatches, ".*overflowed configured field length.*")
+
+	type truncated struct {
+		Value string `length:"3" truncate:"true"`
+	}
+	data, err := Marshal(&truncated{Value: "Geoff"})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "Geo")
+}
+
+// Test that repeated fields are written element by element, with
+// short slices padded using zero values.
+func (s *WriteSuite) TestMarshalSlice(c *C) {
+	type target struct {
+		Values []int `encoding:"ascii" length:"2" repeat:"4"`
+	}
+	t := &target{Values: []int{1, 22, 3}}
+	data, err := Marshal(t)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, " 122 3 0")
+}
+
+// Test that writing a slice longer than its repeat count fails.
+func (s *WriteSuite) TestMarshalSliceTooLong(c *C) {
+	type target struct {
+		Values []int `encoding:"ascii" length:"1" repeat:"2"`
+	}
+	t := &target{Values: []int{1, 2, 3}}
+	_, err := Marshal(t)
+	c.Assert(err, ErrorMatches, ".*has 3 elements, but only 2 may be written")
+}
+
+// Test that populateBytesFromSpecAndStruct copes with nested structs
+func (s *WriteSuite) TestPopulateBytesFromNestedStruct(c *C) {
+	transaction := &Transaction{
+		Buyer:  Person{Name: "Geoff", Age: 37},
+		Seller: Person{Name: "Elisa", Age: 4}}
+	specs, err := buildSpecs(transaction)
+	c.Assert(err, IsNil)
+	data, err := populateBytesFromSpecAndStruct(specs)
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte("Geoff\x25Elisa\x04"))
+}
+
 func (s *WriteSuite) TestPopulateBytesFromSpecAndStruct(c *C) {
 	var data []byte
 	var specs []spec
@@ -111,6 +429,14 @@ func (s *WriteSuite) TestPopulateBytesFromSpecAndStruct(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(string(data[0:5]), Equals, "Geoff")
 	c.Assert(string(data[5:17]), Equals, "          36")
+	c.Assert(data[17:19], DeepEquals, []byte("\x00\x0a"))
+	c.Assert(data[19:21], DeepEquals, []byte("\x10\x00"))
+	c.Assert(data[21:29], DeepEquals, []byte("\x20\x00\x00\x00\x00\x00\x00\x00"))
+	c.Assert(string(data[29:35]), Equals, " 10000")
+	c.Assert(data[35:43], DeepEquals, []byte("\x18\x2d\x44\x54\xfb\x21\x09\x40"))
+	c.Assert(data[43:47], DeepEquals, []byte("\x40\x49\x0f\xdb"))
+	c.Assert(string(data[47:50]), Equals, "\x00Yj")
+	c.Assert(string(data[50:60]), Equals, "0123456789")
 }
 
 
@@ -139,3 +465,147 @@ func (s *WriteSuite) TestMarshal(c *C) {
 	c.Assert(string(data[0:5]), Equals, "Geoff")
 	c.Assert(string(data[5:17]), Equals, "          36")
 }
+
+// Test that Marshal writes fields at their offsets and fills the gaps
+// between them with spaces.
+func (s *WriteSuite) TestMarshalOffsets(c *C) {
+	type record struct {
+		Amount int    `length:"4" encoding:"ascii" offset:"10"`
+		Name   string `length:"5" offset:"0"`
+		Buyer  Person `offset:"15"`
+	}
+	data, err := Marshal(&record{Amount: 42, Name: "Geoff", Buyer: Person{Name: "Elisa", Age: 7}})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "Geoff       42 Elisa\x07")
+}
+
+// Test that Marshal writes filler fields with their fill character
+// and leaves out ignored and unexported fields.
+func (s *WriteSuite) TestMarshalSkipsFields(c *C) {
+	type record struct {
+		Code    string `length:"3"`
+		Derived int    `fixedfield:"-"`
+		_       string `length:"2" fill:"*"`
+		_       int    `length:"1"`
+		cache   string
+		Name    string `length:"5"`
+	}
+	data, err := Marshal(&record{Code: "ABC", Derived: 9, cache: "x", Name: "Geoff"})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "ABC** Geoff")
+}
+
+// Test that Marshal sizes a variable length field to fit its value,
+// and writes that size into the field it refers to.
+func (s *WriteSuite) TestMarshalLengthFrom(c *C) {
+	type record struct {
+		Size    uint16 `length:"2" encoding:"be"`
+		Payload string `lengthFrom:"Size"`
+		Code    string `length:"3"`
+	}
+	target := &record{Size: 99, Payload: "Geoff ", Code: "ABC"}
+	data, err := Marshal(target)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "\x00\x06Geoff ABC")
+	c.Assert(target.Size, Equals, uint16(99))
+
+	type tooLong struct {
+		Size    uint8  `length:"1"`
+		Payload string `lengthFrom:"Size"`
+	}
+	_, err = Marshal(&tooLong{Payload: strings.Repeat("x", 256)})
+	c.Assert(err, ErrorMatches, "Field .*Payload is 256 bytes long, which is too long for field Size")
+}
+
+// Test that Marshal writes every element of a variable repeat field,
+// and writes the number of elements into the field it refers to.
+func (s *WriteSuite) TestMarshalRepeatFrom(c *C) {
+	type record struct {
+		Count int    `length:"2" encoding:"ascii"`
+		Items []int  `length:"3" encoding:"ascii" repeatFrom:"Count" maxRepeat:"3"`
+		Code  string `length:"3"`
+	}
+	data, err := Marshal(&record{Items: []int{1, 2}, Code: "ABC"})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, " 2  1  2ABC")
+
+	data, err = Marshal(&record{Code: "ABC"})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, " 0ABC")
+
+	_, err = Marshal(&record{Items: []int{1, 2, 3, 4}})
+	c.Assert(err, ErrorMatches, "Field .*Items has 4 elements, but only 3 may be written")
+
+	type narrow struct {
+		Count uint8 `length:"1"`
+		Items []int `length:"1" encoding:"ascii" repeatFrom:"Count"`
+	}
+	_, err = Marshal(&narrow{Items: make([]int, 300)})
+	c.Assert(err, ErrorMatches, "Field .*Items has 300 elements, which is too many for field Count")
+}
+
+// Test that Marshal writes each element of a slice of structs, padding
+// short slices with zero structs.
+func (s *WriteSuite) TestMarshalSliceOfStructs(c *C) {
+	type record struct {
+		People []Person `repeat:"3"`
+		Count  int      `length:"1" encoding:"ascii"`
+		Others []Person `repeatFrom:"Count"`
+	}
+	data, err := Marshal(&record{
+		People: []Person{{"Geoff", 37}, {"Elisa", 4}},
+		Others: []Person{{"Alan", 7}},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "Geoff\x25Elisa\x04     \x001Alan \x07")
+}
+
+// Test that Marshal writes every element of an array.
+func (s *WriteSuite) TestMarshalArrays(c *C) {
+	type record struct {
+		Ratings [3]int `length:"1" encoding:"ascii"`
+		Flags   [2]byte
+		People  [2]Person
+	}
+	data, err := Marshal(&record{
+		Ratings: [3]int{1, 2, 3},
+		Flags:   [2]byte{1, 2},
+		People:  [2]Person{{"Geoff", 37}},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "123\x01\x02Geoff\x25     \x00")
+}
+
+// Test that Marshal refuses to write fields that share a count field
+// but need different counts.
+func (s *WriteSuite) TestMarshalRepeatFromSharedCount(c *C) {
+	type record struct {
+		Count  int   `length:"1" encoding:"ascii"`
+		Items  []int `length:"1" encoding:"ascii" repeatFrom:"Count" maxRepeat:"9"`
+		Prices []int `length:"2" encoding:"ascii" repeatFrom:"Count" maxRepeat:"9"`
+	}
+	data, err := Marshal(&record{Items: []int{1, 2}, Prices: []int{10, 20}})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "2121020")
+
+	_, err = Marshal(&record{Items: []int{1, 2}, Prices: []int{10}})
+	c.Assert(err, ErrorMatches,
+		"Fields .*record.Items and .*record.Prices share count field Count, but need counts of 2 and 1")
+}
+
+// Test that repeated string fields are padded with spaces, so values
+// ending in the digit zero survive the round trip.
+func (s *WriteSuite) TestMarshalUnmarshalRepeatedStrings(c *C) {
+	type record struct {
+		Names []string  `length:"5" repeat:"2"`
+		Codes [2]string `length:"3"`
+	}
+	data, err := Marshal(&record{Names: []string{"ab", "100"}, Codes: [2]string{"x0", "20"}})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "ab   100  x0 20 ")
+	result := &record{}
+	err = Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Names, DeepEquals, []string{"ab", "100"})
+	c.Assert(result.Codes, Equals, [2]string{"x0", "20"})
+}
@@ -0,0 +1,125 @@
+package fixedfield
+
+import (
+	"fmt"
+)
+
+// In ASCII, the sign of a zoned decimal is "overpunched" on to one of
+// its digits using these characters, indexed by digit.
+const (
+	zonedPositiveASCII = "{ABCDEFGHI"
+	zonedNegativeASCII = "}JKLMNOPQR"
+)
+
+// Decode a single zoned decimal character, returning its digit and
+// whether it carries a negative sign.  Only the sign position may
+// carry a sign.
+func readZonedDigit(b byte, ebcdic bool, signPosition bool) (digit int64, negative bool, err error) {
+	if ebcdic {
+		digit = int64(b & 0x0f)
+		if digit <= 9 {
+			switch b >> 4 {
+			case 0x0f:
+				return digit, false, nil
+			case 0x0c, 0x0a, 0x0e:
+				if signPosition {
+					return digit, false, nil
+				}
+			case 0x0d, 0x0b:
+				if signPosition {
+					return digit, true, nil
+				}
+			}
+		}
+	} else {
+		if b >= '0' && b <= '9' {
+			return int64(b - '0'), false, nil
+		}
+		if signPosition {
+			for i := 0; i < 10; i++ {
+				if b == zonedPositiveASCII[i] {
+					return int64(i), false, nil
+				}
+				if b == zonedNegativeASCII[i] {
+					return int64(i), true, nil
+				}
+			}
+		}
+	}
+	return 0, false, fmt.Errorf("Invalid zoned decimal character %q", b)
+}
+
+// Convert a block of COBOL zoned decimal (display) data into a signed
+// 64 bit integer.  The sign is overpunched on either the first or the
+// last digit, in ASCII or EBCDIC form.
+func readZonedDecimal(block []byte, ebcdic bool, leading bool) (value int64, err error) {
+	var digit int64
+	var negative, isNegative bool
+	var signIndex int = len(block) - 1
+
+	if len(block) == 0 {
+		return 0, fmt.Errorf("Zoned decimals must be at least 1 byte long")
+	}
+	if leading {
+		signIndex = 0
+	}
+	for i, b := range block {
+		digit, isNegative, err = readZonedDigit(b, ebcdic, i == signIndex)
+		if err != nil {
+			return 0, fmt.Errorf("%s in zoned decimal %q", err, block)
+		}
+		negative = negative || isNegative
+		if value > (maxInt64-digit)/10 {
+			return 0, fmt.Errorf("Zoned decimal %q overflows a 64 bit integer", block)
+		}
+		value = value*10 + digit
+	}
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
+
+// Convert a signed 64 bit integer into a block of COBOL zoned decimal
+// data of a known length.  Signed values have their sign overpunched
+// on the first or last digit, unsigned values are plain digits.
+func marshalZonedDecimal(value int64, blockLength int, signed bool, leading bool, ebcdic bool) (block []byte, err error) {
+	var magnitude uint64
+	var digit byte
+	var negative bool = value < 0
+	var signIndex int = blockLength - 1
+
+	if negative && !signed {
+		return nil, fmt.Errorf("Value %d cannot be written as an unsigned zoned decimal", value)
+	}
+	magnitude = uint64(value)
+	if negative {
+		magnitude = uint64(-value)
+	}
+	if leading {
+		signIndex = 0
+	}
+	block = make([]byte, blockLength)
+	for i := blockLength - 1; i >= 0; i-- {
+		digit = byte(magnitude % 10)
+		magnitude /= 10
+		switch {
+		case signed && i == signIndex && ebcdic && negative:
+			block[i] = 0xd0 | digit
+		case signed && i == signIndex && ebcdic:
+			block[i] = 0xc0 | digit
+		case signed && i == signIndex && negative:
+			block[i] = zonedNegativeASCII[digit]
+		case signed && i == signIndex:
+			block[i] = zonedPositiveASCII[digit]
+		case ebcdic:
+			block[i] = 0xf0 | digit
+		default:
+			block[i] = '0' + digit
+		}
+	}
+	if magnitude != 0 {
+		return nil, fmt.Errorf("Value %d overflows a %d byte zoned decimal", value, blockLength)
+	}
+	return block, nil
+}
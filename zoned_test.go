@@ -0,0 +1,94 @@
+package fixedfield
+
+import (
+	. "launchpad.net/gocheck"
+)
+
+type ZonedSuite struct{}
+
+var _ = Suite(&ZonedSuite{})
+
+// Test readZonedDecimal decodes ASCII overpunched values.
+func (s *ZonedSuite) TestReadZonedDecimalASCII(c *C) {
+	value, err := readZonedDecimal([]byte("0012E"), false, false)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(125))
+	value, err = readZonedDecimal([]byte("0012}"), false, false)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(-120))
+	value, err = readZonedDecimal([]byte("R0012"), false, true)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(-90012))
+	value, err = readZonedDecimal([]byte("00123"), false, false)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(123))
+}
+
+// Test readZonedDecimal decodes EBCDIC zoned values.
+func (s *ZonedSuite) TestReadZonedDecimalEBCDIC(c *C) {
+	value, err := readZonedDecimal([]byte("\xf0\xf1\xf2\xc5"), true, false)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(125))
+	value, err = readZonedDecimal([]byte("\xd1\xf2\xf3"), true, true)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(-123))
+	value, err = readZonedDecimal([]byte("\xf4\xf2"), true, false)
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, int64(42))
+}
+
+// Test readZonedDecimal rejects signs away from the sign position and
+// invalid characters.
+func (s *ZonedSuite) TestReadZonedDecimalInvalid(c *C) {
+	_, err := readZonedDecimal([]byte("0J12"), false, false)
+	c.Assert(err, ErrorMatches, `Invalid zoned decimal character 'J' in zoned decimal "0J12"`)
+	_, err = readZonedDecimal([]byte("\xc1\xf2"), true, false)
+	c.Assert(err, ErrorMatches, "Invalid zoned decimal character.*")
+	_, err = readZonedDecimal([]byte(" 12"), false, false)
+	c.Assert(err, ErrorMatches, "Invalid zoned decimal character ' '.*")
+}
+
+// Test marshalZonedDecimal in each sign position and character set.
+func (s *ZonedSuite) TestMarshalZonedDecimal(c *C) {
+	block, err := marshalZonedDecimal(-1235, 5, true, false, false)
+	c.Assert(err, IsNil)
+	c.Assert(string(block), Equals, "0123N")
+	block, err = marshalZonedDecimal(120, 4, true, true, false)
+	c.Assert(err, IsNil)
+	c.Assert(string(block), Equals, "{120")
+	block, err = marshalZonedDecimal(120, 4, false, false, false)
+	c.Assert(err, IsNil)
+	c.Assert(string(block), Equals, "0120")
+	block, err = marshalZonedDecimal(-123, 3, true, false, true)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\xf1\xf2\xd3"))
+	block, err = marshalZonedDecimal(42, 2, false, false, true)
+	c.Assert(err, IsNil)
+	c.Assert(block, DeepEquals, []byte("\xf4\xf2"))
+	_, err = marshalZonedDecimal(1234, 3, true, false, false)
+	c.Assert(err, ErrorMatches, "Value 1234 overflows a 3 byte zoned decimal")
+	_, err = marshalZonedDecimal(-1, 3, false, false, false)
+	c.Assert(err, ErrorMatches, "Value -1 cannot be written as an unsigned zoned decimal")
+}
+
+// PIC S9(5) and PIC S9(3)V99 fields round trip through Marshal and
+// Unmarshal in ASCII and EBCDIC.
+func (s *ZonedSuite) TestMarshalUnmarshalZoned(c *C) {
+	type record struct {
+		Count   int     `length:"5" encoding:"zoned"`
+		Units   uint    `length:"3" encoding:"zoned"`
+		Amount  float64 `length:"5" encoding:"zoned" scale:"2" sign:"leading"`
+		Balance Decimal `length:"5" encoding:"zoned" scale:"2" charset:"273"`
+	}
+	data := []byte("0012}" + "042" + "J2345" + "\xf1\xf2\xf3\xf4\xc5")
+	result := &record{}
+	err := Unmarshal(data, result)
+	c.Assert(err, IsNil)
+	c.Assert(result.Count, Equals, -120)
+	c.Assert(result.Units, Equals, uint(42))
+	c.Assert(result.Amount, Equals, -123.45)
+	c.Assert(result.Balance, Equals, Decimal{Unscaled: 12345, Scale: 2})
+	output, err := Marshal(result)
+	c.Assert(err, IsNil)
+	c.Assert(output, DeepEquals, data)
+}